@@ -39,6 +39,23 @@ func GetPollInterval() time.Duration {
 	return time.Duration(minutes) * time.Minute
 }
 
+// GetCacheMaxAge reads WARSCRY_CACHE_MAX_AGE env var
+// Returns how long clients may reuse data responses before revalidating, in seconds; 0 always revalidates
+func GetCacheMaxAge() time.Duration {
+	maxAgeStr := os.Getenv("WARSCRY_CACHE_MAX_AGE")
+	if maxAgeStr == "" {
+		return 60 * time.Second // default: 1 minute
+	}
+
+	seconds, err := strconv.Atoi(maxAgeStr)
+	if err != nil || seconds < 0 {
+		log.Printf("WARNING: invalid WARSCRY_CACHE_MAX_AGE '%s', using default (60 sec)", maxAgeStr)
+		return 60 * time.Second
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
 func main() {
 	// Create data store
 	dataStore := warscry.NewDataStore()
@@ -51,7 +68,7 @@ func main() {
 	abilities.FromGit()
 	warbands := warscry.LoadWarbands(&fighters, &abilities)
 
-	dataStore.LoadData(&fighters, &abilities, warbands)
+	dataStore.LoadData(&fighters, &abilities, warbands, warscry.DataSourceURL)
 
 	if len(fighters) == 0 || len(abilities) == 0 {
 		log.Fatalln("initial data load failed")
@@ -72,18 +89,40 @@ func main() {
 
 	mux := http.NewServeMux()
 
+	// Cache policies: data responses may be reused for the configured max-age, then revalidated with
+	// their ETag; health checks are never cached
+	dataPolicy := warscry.CachePolicy{MaxAge: GetCacheMaxAge()}
+	noStore := warscry.CachePolicy{NoStore: true}
+	cached := func(handler http.Handler, policy warscry.CachePolicy) http.Handler {
+		return &warscry.CacheHandler{Handler: handler, DataStore: dataStore, Policy: policy}
+	}
+
 	// Register the routes and handlers
 	mux.Handle("/", &warscry.RootHandler{
 		Version:   "v0.2.0",
 		DataStore: dataStore,
 		DocsURL:   "https://github.com/krisling049/warscry/blob/main/openapi.yaml",
 	})
-	mux.Handle("/fighters", &warscry.FighterHandler{DataStore: dataStore})
-	mux.Handle("/abilities", &warscry.AbilityHandler{DataStore: dataStore})
-	mux.Handle("/health", &warscry.HealthHandler{DataStore: dataStore})
+	fighterHandler := cached(&warscry.FighterHandler{DataStore: dataStore}, dataPolicy)
+	mux.Handle("/fighters", fighterHandler)
+	mux.Handle("/fighters/", fighterHandler)
+	abilityHandler := cached(&warscry.AbilityHandler{DataStore: dataStore}, dataPolicy)
+	mux.Handle("/abilities", abilityHandler)
+	mux.Handle("/abilities/", abilityHandler)
+	warbandHandler := cached(&warscry.WarbandHandler{DataStore: dataStore}, dataPolicy)
+	mux.Handle("/warbands", warbandHandler)
+	mux.Handle("/warbands/", warbandHandler)
+	mux.Handle("/weapons", cached(&warscry.WeaponHandler{DataStore: dataStore}, dataPolicy))
+	mux.Handle("/calculate/attack", &warscry.CalculatorHandler{DataStore: dataStore})
+	mux.Handle("/matchups", cached(&warscry.MatchupHandler{DataStore: dataStore}, dataPolicy))
+	mux.Handle("/rosters/", cached(&warscry.RosterHandler{DataStore: dataStore, Rules: warscry.DefaultRosterRules}, dataPolicy))
+	mux.Handle("/search", cached(&warscry.SearchHandler{DataStore: dataStore}, dataPolicy))
+	mux.Handle("/suggest", cached(&warscry.SuggestHandler{DataStore: dataStore}, dataPolicy))
+	mux.Handle("/quality", cached(&warscry.QualityHandler{DataStore: dataStore}, dataPolicy))
+	mux.Handle("/health", cached(&warscry.HealthHandler{DataStore: dataStore}, noStore))
 
-	// Run the server
-	serveErr := http.ListenAndServe(GetPort(), mux)
+	// Run the server, compressing every response the client accepts gzip or deflate for
+	serveErr := http.ListenAndServe(GetPort(), &warscry.CompressHandler{Handler: mux})
 	if serveErr != nil {
 		log.Fatalln(serveErr)
 	}
@@ -1,6 +1,11 @@
 package warscry
 
-import "net/http"
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 func (A *Abilities) GetWarband(factionRunemark string) *Abilities {
 	warband := Abilities{}
@@ -20,16 +25,80 @@ func (A *Abilities) GetIds() []string {
 	return Ids
 }
 
+// IndexById maps each ability _id to its entry in the collection
+func (A *Abilities) IndexById() map[AbilityID]*Ability {
+	index := make(map[AbilityID]*Ability, len(*A))
+	for i := range *A {
+		index[(*A)[i].Id] = &(*A)[i]
+	}
+	return index
+}
+
+// UniversalFaction is the faction runemark of abilities available to every warband
+const UniversalFaction = "universal"
+
+// UsableBy reports whether the fighter can use the ability: it must belong to the fighter's warband or
+// subfaction, or be universal, and the fighter must have every runemark the ability requires
+func (a *Ability) UsableBy(f *Fighter) bool {
+	switch {
+	case a.Universal:
+	case strings.EqualFold(a.FactionRunemark, f.FactionRunemark):
+	case f.Subfaction != "" && strings.EqualFold(a.FactionRunemark, f.Subfaction):
+	default:
+		return false
+	}
+	for _, runemark := range a.Runemarks {
+		if !slices.Contains(f.Runemarks, runemark) {
+			return false
+		}
+	}
+	return true
+}
+
+// Universal returns the abilities available to every warband
+func (A *Abilities) Universal() Abilities {
+	universal := Abilities{}
+	for _, a := range *A {
+		if a.Universal {
+			universal = append(universal, a)
+		}
+	}
+	return universal
+}
+
+// UsableBy returns the abilities and battle traits the fighter can use, in collection order
+func (A *Abilities) UsableBy(f *Fighter) Abilities {
+	usable := Abilities{}
+	for i := range *A {
+		if (*A)[i].UsableBy(f) {
+			usable = append(usable, (*A)[i])
+		}
+	}
+	return usable
+}
+
 func (a *Ability) MatchesRequest(r *http.Request) (bool, error) {
 	var conditions []bool
 
 	// ability characteristics
-	conditions = append(conditions, StringInclude(a.Id, r.Form["_id"]))
-	conditions = append(conditions, StringInclude(a.Name, r.Form["name"]))
-	conditions = append(conditions, StringInclude(a.FactionRunemark, r.Form["warband"]))
-	conditions = append(conditions, StringInclude(a.Type, r.Form["cost"]))
-	conditions = append(conditions, SubStringInclude(a.Description, r.Form["description"]))
-	conditions = append(conditions, StringSliceInclude(a.Runemarks, r.Form["runemarks"]))
+	conditions = append(conditions, StringParamInclude(a.Id, r.Form, "_id"))
+	conditions = append(conditions, StringParamInclude(a.Name, r.Form, "name"))
+	conditions = append(conditions, FuzzyParamInclude(a.Name, r.Form, "name"))
+	conditions = append(conditions, StringParamInclude(a.FactionRunemark, r.Form, "warband"))
+	conditions = append(conditions, StringParamInclude(string(a.Type), r.Form, "cost"))
+	conditions = append(conditions, CostParamInclude(a.Type, r.Form, "cost"))
+	conditions = append(conditions, StringParamInclude(strconv.FormatBool(a.Universal), r.Form, "universal"))
+	conditions = append(conditions, TextParamInclude(a.Description, r.Form, "description"))
+	conditions = append(conditions, StringSliceParamInclude(a.Runemarks, r.Form, "runemarks"))
+
+	// parsed effects
+	conditions = append(conditions, StringSliceParamInclude(a.Effects.Keywords, r.Form, "effect"))
+	conditions = append(conditions, StringSliceParamInclude(a.Effects.Targets, r.Form, "target"))
+	inRange, rangeErr := rangeParamInclude(&a.Effects, r.Form)
+	if rangeErr != nil {
+		return false, rangeErr
+	}
+	conditions = append(conditions, inRange)
 
 	if All(conditions) {
 		return true, nil
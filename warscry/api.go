@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type FighterHandler struct {
@@ -19,6 +23,14 @@ type AbilityHandler struct {
 	DataStore *DataStore
 }
 
+type WarbandHandler struct {
+	DataStore *DataStore
+}
+
+type WeaponHandler struct {
+	DataStore *DataStore
+}
+
 type RootHandler struct {
 	Version   string
 	DataStore *DataStore
@@ -39,9 +51,13 @@ type HealthHandler struct {
 }
 
 type HealthResponse struct {
-	Status          string `json:"status"`
-	FightersLoaded  int    `json:"fighters_loaded"`
-	AbilitiesLoaded int    `json:"abilities_loaded"`
+	Status          string    `json:"status"`
+	FightersLoaded  int       `json:"fighters_loaded"`
+	AbilitiesLoaded int       `json:"abilities_loaded"`
+	DataVersion     uint64    `json:"data_version"`
+	DataHash        string    `json:"data_hash"`
+	LoadedAt        time.Time `json:"loaded_at"`
+	Source          string    `json:"source"`
 }
 
 func (R *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -51,13 +67,13 @@ func (R *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	wantsJSON := strings.Contains(accept, "application/json")
 	wantsHTML := strings.Contains(accept, "text/html")
 
-	// Get current counts from DataStore
-	fighterCount, abilityCount := R.DataStore.GetCounts()
+	// Get current counts from one DataStore snapshot, identified in the response headers
+	fighterCount, abilityCount := R.DataStore.SnapshotFor(w).GetCounts()
 
 	apiInfo := APIInfo{
 		Name:         "Warcry API",
 		Version:      R.Version,
-		Endpoints:    []string{"/", "/fighters", "/abilities", "/health"},
+		Endpoints:    []string{"/", "/fighters", "/abilities", "/warbands", "/weapons", "/calculate/attack", "/matchups", "/rosters/validate", "/rosters/options", "/rosters/encode", "/rosters/export", "/rosters/import", "/search", "/suggest", "/quality", "/health"},
 		FighterCount: fighterCount,
 		AbilityCount: abilityCount,
 		DocsURL:      R.DocsURL,
@@ -104,19 +120,116 @@ func (R *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         <p><strong>Examples:</strong></p>
         <pre>GET /fighters?attacks__gte=4
 GET /fighters?wounds__gt=20&toughness__gte=5
-GET /fighters?warband=stormcast-eternals&runemarks=hero</pre>
-        <p><strong>Operators:</strong> <code>__gt</code> (greater than), <code>__gte</code> (greater or equal), <code>__lt</code> (less than), <code>__lte</code> (less or equal)</p>
+GET /fighters?warband=stormcast-eternals&runemarks=hero
+GET /fighters?q=(runemarks:hero OR runemarks:leader) AND NOT warband:khorne AND wounds>=20
+GET /fighters/{_id}</pre>
+        <p><strong>Operators:</strong> <code>__gt</code> (greater than), <code>__gte</code> (greater or equal), <code>__lt</code> (less than), <code>__lte</code> (less or equal), <code>__ne</code> (not equal), <code>__in</code> (any of 1,2,3), <code>__between</code> (inclusive min,max)</p>
+        <p><strong>Text operators:</strong> <code>__contains</code>, <code>__startswith</code>, <code>__regex</code>, <code>__not</code>/<code>__ne</code></p>
     </div>
     <div class="endpoint">
         <h3>GET /abilities</h3>
         <p>Query abilities by characteristics.</p>
         <p><strong>Examples:</strong></p>
         <pre>GET /abilities?warband=stormcast-eternals
-GET /abilities?description=wounds</pre>
+GET /abilities?description=wounds
+GET /abilities?cost__gte=triple
+GET /abilities?effect=heal&range__lte=6
+GET /abilities?usable_by={fighter _id}
+GET /abilities/{_id}
+GET /abilities/{_id}/fighters
+GET /fighters/{_id}/abilities</pre>
+    </div>
+    <div class="endpoint">
+        <h3>GET /warbands</h3>
+        <p>Fighters, abilities and battle traits grouped by warband. Use <code>/warbands/{name}</code> for a single warband and <code>/warbands/{name}/subfactions</code> for its subfactions.</p>
+        <p><strong>Examples:</strong></p>
+        <pre>GET /warbands?grand_alliance=order
+GET /warbands/stormcast-eternals
+GET /warbands?exclude=fighters&exclude=abilities
+GET /warbands/khorne?include_universal=true
+GET /warbands?bladeborn=true
+GET /warbands/khorne/subfactions</pre>
+    </div>
+    <div class="endpoint">
+        <h3>GET /weapons</h3>
+        <p>Query weapon profiles, flattened with the id, name and warband of the fighter carrying them.</p>
+        <p><strong>Examples:</strong></p>
+        <pre>GET /weapons?min_range__gte=3&sort=-attacks
+GET /weapons?warband=khorne&strength__gte=5</pre>
+    </div>
+    <div class="endpoint">
+        <h3>POST /calculate/attack</h3>
+        <p>Exact damage distribution of one attack action, and the chance to take the target down in N attack actions.</p>
+        <p><strong>Example body:</strong></p>
+        <pre>{"attacker": {"fighter_id": "...", "weapon": 0}, "target": {"toughness": 4, "wounds": 20}, "modifiers": {"attacks": 1}}</pre>
+    </div>
+    <div class="endpoint">
+        <h3>GET /matchups</h3>
+        <p>Matrix of expected damage and attack actions to kill, for attackers against targets chosen with <code>/fighters</code> filters prefixed by <code>attacker.</code> and <code>target.</code></p>
+        <p><strong>Examples:</strong></p>
+        <pre>GET /matchups?attacker.warband=stormcast-eternals&target.warband=khorne
+GET /matchups?attacker.runemarks=hero&target.wounds__gte=20&format=csv&metric=actions_to_kill</pre>
+    </div>
+    <div class="endpoint">
+        <h3>POST /rosters/validate</h3>
+        <p>Check a roster against the list-building rules: points, factions, leaders, heroes, allies, thralls and fighter counts. Every broken rule is listed with a machine-readable code.</p>
+        <p><strong>Example body:</strong></p>
+        <pre>{"warband": "stormcast-eternals", "points_limit": 1000, "fighters": [{"fighter_id": "...", "count": 2}]}</pre>
+    </div>
+    <div class="endpoint">
+        <h3>POST /rosters/options</h3>
+        <p>Fighters that can still legally be added to a partial roster, grouped by warband and subfaction, with the reasons each other fighter is ineligible. Narrow the candidates with any <code>/fighters</code> filter in the query string.</p>
+        <p><strong>Example:</strong></p>
+        <pre>POST /rosters/options?runemarks=hero&points__lte=150
+{"points_limit": 1000, "fighters": [{"fighter_id": "..."}]}</pre>
+    </div>
+    <div class="endpoint">
+        <h3>POST /rosters/encode, GET /rosters/{code}</h3>
+        <p>Turn a roster into a short, URL-safe code to share, and decode it back into full fighters. Decoding flags fighters whose points or profile changed since the code was made.</p>
+        <p><strong>Examples:</strong></p>
+        <pre>POST /rosters/encode
+{"warband": "stormcast-eternals", "fighters": [{"fighter_id": "...", "count": 2}]}
+GET /rosters/1.FMq5CcUwDADQ...</pre>
+    </div>
+    <div class="endpoint">
+        <h3>POST /rosters/export</h3>
+        <p>Render a roster with its fighter profiles, weapons, abilities and battle traits as Markdown, plain text or a Tabletop Simulator saved object with one notecard per fighter.</p>
+        <p><strong>Example:</strong></p>
+        <pre>POST /rosters/export?format=tts
+{"fighters": [{"fighter_id": "...", "count": 2}]}</pre>
+    </div>
+    <div class="endpoint">
+        <h3>POST /rosters/import</h3>
+        <p>Resolve a pasted list, one fighter per line with optional counts and points, into a roster. Names are fuzzy-matched within the detected warband, and each line is reported as matched, ambiguous or unmatched, with points that differ from current data flagged.</p>
+        <p><strong>Example body:</strong></p>
+        <pre>{"text": "Stormcast Eternals - 1000 pts\nLord-Celestant (190)\n3x Liberator (285)"}</pre>
+    </div>
+    <div class="endpoint">
+        <h3>GET /search</h3>
+        <p>Ranked full-text search across fighter names, runemarks, weapons and warbands and ability names and descriptions. Words are stemmed, so "wounding" finds "wounds", and each result carries a highlighted snippet.</p>
+        <p><strong>Examples:</strong></p>
+        <pre>GET /search?q=lord celestant
+GET /search?q=wounding&type=ability</pre>
+    </div>
+    <div class="endpoint">
+        <h3>GET /suggest</h3>
+        <p>Autocomplete fighter, ability, warband and runemark names, with typo-tolerant fallbacks. Use <code>name__fuzzy</code> on /fighters and /abilities for the same typo-tolerant lookup.</p>
+        <p><strong>Examples:</strong></p>
+        <pre>GET /suggest?q=lord&type=fighter
+GET /fighters?name__fuzzy=Lord-Celestnt</pre>
+    </div>
+    <div class="endpoint">
+        <h3>GET /quality</h3>
+        <p>Data quality report listing ability descriptions the effects parser could not fully read.</p>
+        <p><strong>Examples:</strong></p>
+        <pre>GET /quality
+GET /quality?code=no_effects</pre>
     </div>
     <div class="endpoint">
         <h3>GET /health</h3>
-        <p>Health check endpoint. Returns API status.</p>
+        <p>Health check endpoint. Returns API status and the version, hash, load time and source of the current data. Every response carries <code>X-Data-Version</code> and <code>X-Data-Hash</code> headers identifying the data it was built from.</p>
+        <p>Successful GET responses carry <code>ETag</code>, <code>Last-Modified</code> and <code>Cache-Control</code> headers. Send them back in <code>If-None-Match</code> or <code>If-Modified-Since</code> to get a <code>304 Not Modified</code> while the data is unchanged.</p>
+        <p>Responses are compressed with gzip or deflate when the request's <code>Accept-Encoding</code> allows it.</p>
     </div>
     <h2>Documentation</h2>
     <p>OpenAPI specification: <a href="%s">%s</a></p>
@@ -137,19 +250,54 @@ GET /abilities?description=wounds</pre>
 Data loaded: %d fighters, %d abilities
 
 Endpoints:
-- GET /fighters - Query fighters by characteristics
-- GET /abilities - Query abilities
-- GET /health - Health check
+- GET /fighters - Query fighters by characteristics, or /fighters/{_id} for a single fighter
+- GET /abilities - Query abilities, or /abilities/{_id} for a single ability
+- GET /fighters/{_id}/abilities - Abilities a fighter can use, or /abilities/{_id}/fighters for the reverse
+- GET /warbands - Query warbands, or /warbands/{name} for a single warband
+- GET /warbands/{name}/subfactions - Subfactions of a warband, with bladeborn and heroes-all flags
+- GET /weapons - Query weapon profiles
+- POST /calculate/attack - Attack damage distribution and kill chances
+- GET /matchups - Expected damage of attackers against targets
+- POST /rosters/validate - Check a roster against the list-building rules
+- POST /rosters/options - Fighters that can still legally be added to a roster
+- POST /rosters/encode - Shareable roster code, decoded with GET /rosters/{code}
+- POST /rosters/export - Roster as Markdown, plain text or Tabletop Simulator JSON
+- POST /rosters/import - Roster from a pasted text list
+- GET /search - Ranked full-text search across fighters and abilities
+- GET /suggest - Name autocomplete with typo-tolerant fallbacks
+- GET /quality - Ability descriptions the effects parser could not fully read
+- GET /health - Health check and current data version
 
 Fighter characteristics can be queried using ?characteristic=value
 Example: /fighters?attacks=4
 
-Append operators (__gt, __gte, __lt, __lte) for comparisons
+Append operators (__gt, __gte, __lt, __lte, __ne, __in, __between) for comparisons
 Example: /fighters?attacks__gte=4
 
+Append operators (__contains, __startswith, __regex, __not, __ne) to text and runemark parameters
+Example: /fighters?name__contains=knight
+
+Use name__fuzzy to tolerate typos in names
+Example: /fighters?name__fuzzy=Lord-Celestnt
+
+Combine conditions with AND, OR, NOT and parentheses using q=
+Example: /fighters?q=(runemarks:hero OR runemarks:leader) AND NOT warband:khorne
+
 For abilities, use description=word to search descriptions
 Example: /abilities?description=wounds
 
+Compare dice costs with cost__gte and cost__lte
+Example: /abilities?cost__gte=triple
+
+Filter on effects parsed from descriptions with effect, target and range
+Example: /abilities?effect=heal&range__lte=6
+
+Every response carries X-Data-Version and X-Data-Hash headers identifying the data it was built from
+
+Successful GET responses carry ETag and Last-Modified; send them in If-None-Match or If-Modified-Since for a 304 Not Modified
+
+Responses are compressed with gzip or deflate when Accept-Encoding allows it
+
 Documentation: %s
 `, R.Version, fighterCount, abilityCount, R.DocsURL)
 	if _, err := w.Write([]byte(plainText)); err != nil {
@@ -158,17 +306,22 @@ Documentation: %s
 }
 
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	// Get current counts and load details from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	fighterCount, abilityCount := snap.GetCounts()
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.WriteHeader(http.StatusOK)
 
-	// Get current counts from DataStore
-	fighterCount, abilityCount := h.DataStore.GetCounts()
-
 	response := HealthResponse{
 		Status:          "ok",
 		FightersLoaded:  fighterCount,
 		AbilitiesLoaded: abilityCount,
+		DataVersion:     snap.Version,
+		DataHash:        snap.Hash,
+		LoadedAt:        snap.LoadedAt,
+		Source:          snap.Source,
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -186,9 +339,13 @@ type QueryError struct {
 	Parameter string
 	Value     string
 	Reason    string
+	Position  int // 1-based position of the error within Value, 0 if not applicable
 }
 
 func (e QueryError) Error() string {
+	if e.Position > 0 {
+		return fmt.Sprintf("invalid query parameter '%s=%s': %s at position %d", e.Parameter, e.Value, e.Reason, e.Position)
+	}
 	return fmt.Sprintf("invalid query parameter '%s=%s': %s", e.Parameter, e.Value, e.Reason)
 }
 
@@ -201,44 +358,128 @@ func writeErrorJSON(w http.ResponseWriter, statusCode int, errMsg string) {
 	}
 }
 
+// writeJSON marshals v and writes it as a successful JSON response; slices are streamed element by element
+func writeJSON(w http.ResponseWriter, v any) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		writeJSONArray(w, rv)
+		return
+	}
+
+	marshalledResponse, err := json.Marshal(v)
+	if err != nil {
+		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error marshalling response: %v", err))
+		log.Printf("ERROR: failed to marshal response: %s", err)
+		return
+	}
+
+	SetHeaderDefaults(&w)
+	_, writeErr := w.Write(marshalledResponse)
+	if writeErr != nil {
+		log.Printf("WARNING: failed to write response -- %s", writeErr)
+	}
+}
+
 // validFighterParams lists all recognized query parameters for /fighters endpoint
-var validFighterParams = map[string]bool{
+var validFighterParams = map[string]fieldKind{
 	// String params
-	"name": true, "_id": true, "warband": true, "subfaction": true,
-	"grand_alliance": true, "runemarks": true, "weapon_runemark": true,
+	"name": stringField, "_id": stringField, "warband": stringField, "subfaction": stringField,
+	"grand_alliance": stringField, "runemarks": listField, "weapon_runemark": stringField,
+	// Typo-tolerant name lookup
+	"name__fuzzy": controlField,
+	// Ordering, paging and shaping params
+	"sort": controlField, "limit": controlField, "offset": controlField, "cursor": controlField,
+	"fields": controlField, "expand": controlField,
+	// Weapon matching params
+	"weapon_match": controlField, "weapons": controlField,
+	// Expression param
+	"q": controlField,
 	// Integer params (base names only, operators checked separately)
-	"movement": true, "toughness": true, "wounds": true, "points": true,
-	"attacks": true, "strength": true, "dmg_hit": true, "dmg_crit": true,
-	"min_range": true, "max_range": true,
+	"movement": intField, "toughness": intField, "wounds": intField, "points": intField,
+	"attacks": intField, "strength": intField, "dmg_hit": intField, "dmg_crit": intField,
+	"min_range": intField, "max_range": intField,
 }
 
 // validAbilityParams lists all recognized query parameters for /abilities endpoint
-var validAbilityParams = map[string]bool{
-	"_id": true, "name": true, "warband": true, "cost": true,
-	"description": true, "runemarks": true,
+var validAbilityParams = map[string]fieldKind{
+	"_id": stringField, "name": stringField, "warband": stringField, "cost": stringField,
+	"description": textField, "runemarks": listField, "universal": stringField,
+	// Typo-tolerant name lookup
+	"name__fuzzy": controlField,
+	// Dice cost comparisons, e.g. cost__gte=triple
+	"cost__gte": controlField, "cost__lte": controlField,
+	// Parsed description effects
+	"effect": listField, "target": listField, "range": intField,
+	// Ordering, paging and shaping params
+	"sort": controlField, "limit": controlField, "offset": controlField, "cursor": controlField,
+	"fields": controlField,
+	// Expression param
+	"q": controlField,
+	// Eligibility param, a fighter _id
+	"usable_by": controlField,
+}
+
+// validWeaponParams lists all recognized query parameters for /weapons endpoint
+var validWeaponParams = map[string]fieldKind{
+	// String params
+	"fighter_id": stringField, "fighter_name": stringField, "warband": stringField, "weapon_runemark": stringField,
+	// Ordering and paging params
+	"sort": controlField, "limit": controlField, "offset": controlField, "cursor": controlField,
+	// Integer params (base names only, operators checked separately)
+	"attacks": intField, "strength": intField, "dmg_hit": intField, "dmg_crit": intField,
+	"min_range": intField, "max_range": intField,
+}
+
+// validWarbandParams lists all recognized query parameters for /warbands endpoint
+var validWarbandParams = map[string]fieldKind{
+	"name": stringField, "grand_alliance": stringField, "subfaction": controlField, "exclude": controlField,
+	"include_universal": controlField, "bladeborn": controlField,
 }
 
-// validOperators lists all supported operator suffixes
-var validOperators = []string{"__gt", "__gte", "__lt", "__lte"}
+// validWarbandExclusions lists the nested collections that can be left out of /warbands responses
+var validWarbandExclusions = []string{"fighters", "abilities", "battle_traits", "subfactions"}
+
+// validOperators lists all supported operator suffixes for integer params
+var validOperators = []string{"__gt", "__gte", "__lt", "__lte", "__ne", "__in", "__between"}
 
-// validateQueryParams checks if all query parameters are recognized
+// stringOperators lists all supported operator suffixes for string, list and text params
+var stringOperators = []string{"__contains", "__startswith", "__regex", "__not", "__ne"}
+
+// operatorsFor returns the operator suffixes a param of the given kind accepts
+func operatorsFor(kind fieldKind) []string {
+	switch kind {
+	case intField:
+		return validOperators
+	case stringField, listField, textField:
+		return stringOperators
+	}
+	return nil
+}
+
+// splitOperator splits a param such as "wounds__gte" into its base name and operator suffix
+func splitOperator(param string) (string, string) {
+	for _, ops := range [][]string{validOperators, stringOperators} {
+		for _, op := range ops {
+			if strings.HasSuffix(param, op) {
+				return strings.TrimSuffix(param, op), op
+			}
+		}
+	}
+	return param, ""
+}
+
+// validateQueryParams checks if all query parameters are recognized, including operator suffixes valid for their kind
 // Returns error listing all unrecognized parameters
-func validateQueryParams(form map[string][]string, validParams map[string]bool, allowOperators bool) error {
+func validateQueryParams(form map[string][]string, validParams map[string]fieldKind) error {
 	var invalidParams []string
 
 	for param := range form {
-		valid := validParams[param]
-
-		// If operators allowed, check if param is base + operator
-		if !valid && allowOperators {
-			for _, op := range validOperators {
-				if strings.HasSuffix(param, op) {
-					baseName := strings.TrimSuffix(param, op)
-					if validParams[baseName] {
-						valid = true
-						break
-					}
-				}
+		_, valid := validParams[param]
+
+		// Check if param is base + operator supported by the base param's kind
+		if !valid {
+			baseName, op := splitOperator(param)
+			if kind, exists := validParams[baseName]; exists && op != "" {
+				valid = slices.Contains(operatorsFor(kind), op)
 			}
 		}
 
@@ -248,6 +489,7 @@ func validateQueryParams(form map[string][]string, validParams map[string]bool,
 	}
 
 	if len(invalidParams) > 0 {
+		slices.Sort(invalidParams)
 		return fmt.Errorf("unrecognized query parameters: %s", strings.Join(invalidParams, ", "))
 	}
 	return nil
@@ -273,27 +515,114 @@ func validateIntParam(name string, values []string) error {
 	return nil
 }
 
-// validateIntParams validates all integer parameters in the request
-func validateIntParams(form map[string][]string, paramNames []string) error {
-	for _, param := range paramNames {
-		// Check base param and all operator variants
-		if form[param] != nil {
-			if err := validateIntParam(param, form[param]); err != nil {
-				return err
+// validateIntListParam validates comma-separated integer lists, as used by __in
+func validateIntListParam(name string, values []string) error {
+	for _, val := range values {
+		if _, err := parseIntList(val); err != nil {
+			return QueryError{
+				Parameter: name,
+				Value:     val,
+				Reason:    "must be a comma-separated list of integers",
 			}
 		}
-		for _, op := range validOperators {
-			fullKey := param + op
-			if form[fullKey] != nil {
-				if err := validateIntParam(fullKey, form[fullKey]); err != nil {
-					return err
-				}
+	}
+	return nil
+}
+
+// validateRangeParam validates "min,max" integer ranges, as used by __between
+func validateRangeParam(name string, values []string) error {
+	for _, val := range values {
+		bounds, err := parseIntList(val)
+		if err != nil || len(bounds) != 2 || bounds[0] > bounds[1] {
+			return QueryError{
+				Parameter: name,
+				Value:     val,
+				Reason:    "must be two comma-separated integers, min,max",
 			}
 		}
 	}
 	return nil
 }
 
+// validateRegexParam validates that every value compiles as a regular expression
+func validateRegexParam(name string, values []string) error {
+	for _, val := range values {
+		if _, err := compileRegex(val); err != nil {
+			return QueryError{
+				Parameter: name,
+				Value:     val,
+				Reason:    fmt.Sprintf("must be a valid regular expression: %v", err),
+			}
+		}
+	}
+	return nil
+}
+
+// validateParamValues validates the values of integer, regex and fuzzy parameters in the request
+func validateParamValues(form map[string][]string, validParams map[string]fieldKind) error {
+	for param, values := range form {
+		baseName, op := splitOperator(param)
+		kind, exists := validParams[baseName]
+		if !exists {
+			continue
+		}
+
+		var err error
+		switch {
+		case kind == intField && op == "__in":
+			err = validateIntListParam(param, values)
+		case kind == intField && op == "__between":
+			err = validateRangeParam(param, values)
+		case kind == intField:
+			err = validateIntParam(param, values)
+		case op == "__regex":
+			err = validateRegexParam(param, values)
+		case strings.HasSuffix(param, "__fuzzy"):
+			err = validateFuzzyParam(param, values)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateChoiceParam checks every value of param is one of choices (case-insensitive)
+func validateChoiceParam(form map[string][]string, param string, choices []string) error {
+	for _, v := range form[param] {
+		if !slices.Contains(choices, strings.ToLower(v)) {
+			return QueryError{
+				Parameter: param,
+				Value:     v,
+				Reason:    fmt.Sprintf("must be one of: %s", strings.Join(choices, ", ")),
+			}
+		}
+	}
+	return nil
+}
+
+// validateWarbandExclusions checks every exclude value names a nested warband collection
+func validateWarbandExclusions(values []string) error {
+	for _, v := range values {
+		if !slices.Contains(validWarbandExclusions, strings.ToLower(v)) {
+			return QueryError{
+				Parameter: "exclude",
+				Value:     v,
+				Reason:    fmt.Sprintf("must be one of: %s", strings.Join(validWarbandExclusions, ", ")),
+			}
+		}
+	}
+	return nil
+}
+
+// pathParam returns the path segment following prefix, e.g. "abc" for "/fighters/abc" with prefix "/fighters/"
+func pathParam(r *http.Request, prefix string) string {
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+}
+
 func All(s []bool) bool {
 	var trues int
 
@@ -353,16 +682,10 @@ func LessThanOrEqualTo(characteristic int, maximum int) bool {
 }
 
 func GetOperator(queryKey string) (Operator, error) {
-	OperatorMap := map[string]Operator{
-		"gt":  GreaterThan,
-		"gte": GreaterThanOrEqualTo,
-		"lt":  LessThan,
-		"lte": LessThanOrEqualTo,
-	}
 	if strings.Contains(queryKey, "__") {
 		opString := strings.Split(queryKey, "__")
 		opKey := opString[len(opString)-1]
-		op, exists := OperatorMap[opKey]
+		op, exists := intOperators["__"+opKey]
 		if !exists {
 			return nil, fmt.Errorf("invalid operator: %s", opKey)
 		}
@@ -478,6 +801,181 @@ func StringSliceInclude(characteristic []string, values []string) bool {
 	return Include
 }
 
+// stringPredicate compares a characteristic with a requested value, both already lower-cased
+type stringPredicate func(characteristic string, value string) bool
+
+func equalsString(characteristic string, value string) bool {
+	return characteristic == value
+}
+
+func containsString(characteristic string, value string) bool {
+	return strings.Contains(characteristic, value)
+}
+
+func hasPrefixString(characteristic string, value string) bool {
+	return strings.HasPrefix(characteristic, value)
+}
+
+// regexCache holds compiled __regex patterns so each is compiled once rather than per fighter
+var (
+	regexCache     = make(map[string]*regexp.Regexp)
+	regexCacheLock sync.RWMutex
+)
+
+// maxCachedRegexes bounds regexCache, as patterns come straight from request parameters
+const maxCachedRegexes = 256
+
+// compileRegex compiles a case-insensitive regular expression, reusing previously compiled patterns
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCacheLock.RLock()
+	re, exists := regexCache[pattern]
+	regexCacheLock.RUnlock()
+	if exists {
+		return re, nil
+	}
+
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCacheLock.Lock()
+	if len(regexCache) < maxCachedRegexes {
+		regexCache[pattern] = re
+	}
+	regexCacheLock.Unlock()
+	return re, nil
+}
+
+// MatchAny reports whether the characteristic satisfies the predicate for any value; true if no values requested
+func MatchAny(characteristic string, values []string, p stringPredicate) bool {
+	if len(values) < 1 {
+		return true
+	}
+	characteristic = strings.ToLower(characteristic)
+	for _, v := range values {
+		if p(characteristic, strings.ToLower(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchNone reports whether the characteristic satisfies the predicate for none of the values
+func MatchNone(characteristic string, values []string, p stringPredicate) bool {
+	if len(values) < 1 {
+		return true
+	}
+	return !MatchAny(characteristic, values, p)
+}
+
+// MatchAnyRegex reports whether the characteristic matches any of the patterns; true if no patterns requested
+// Patterns are compiled as given: compileRegex already matches case-insensitively, and lower-casing a pattern
+// would change its meaning, e.g. \S to \s
+func MatchAnyRegex(characteristic string, patterns []string) bool {
+	if len(patterns) < 1 {
+		return true
+	}
+	characteristic = strings.ToLower(characteristic)
+	for _, pattern := range patterns {
+		re, err := compileRegex(pattern)
+		if err == nil && re.MatchString(characteristic) {
+			return true
+		}
+	}
+	return false
+}
+
+// StringParamInclude checks a string characteristic against param and all of its operator variants
+// The param is compiled on every call; compile a stringFilter once to check many characteristics
+func StringParamInclude(characteristic string, form url.Values, param string) bool {
+	filter, err := compileStringFilter(form, param)
+	return err == nil && filter.matches(characteristic)
+}
+
+// FuzzyParamInclude matches a name against param__fuzzy, tolerating typos and partial names
+// A name matches if it is similar enough to any requested value
+func FuzzyParamInclude(name string, form url.Values, param string) bool {
+	values := form[param+"__fuzzy"]
+	if len(values) == 0 {
+		return true
+	}
+	return bestNameSimilarity(values, name) >= minFuzzySimilarity
+}
+
+// CostParamInclude compares the dice cost of an ability against param__gte and param__lte
+// Costs without dice, such as reactions and battle traits, never satisfy a comparison
+func CostParamInclude(cost AbilityCost, form url.Values, param string) bool {
+	var conditions []bool
+	for _, v := range form[param+"__gte"] {
+		conditions = append(conditions, cost.Dice() > 0 && cost.Dice() >= AbilityCost(strings.ToLower(v)).Dice())
+	}
+	for _, v := range form[param+"__lte"] {
+		conditions = append(conditions, cost.Dice() > 0 && cost.Dice() <= AbilityCost(strings.ToLower(v)).Dice())
+	}
+	return All(conditions)
+}
+
+// validateCostParams checks cost comparison values name a cost with a dice cost
+func validateCostParams(form map[string][]string) error {
+	var diceCosts []string
+	for _, c := range AbilityCosts {
+		if c.Dice() > 0 {
+			diceCosts = append(diceCosts, string(c))
+		}
+	}
+	for _, param := range []string{"cost__gte", "cost__lte"} {
+		if err := validateChoiceParam(form, param, diceCosts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TextParamInclude checks a free text characteristic against param and all of its operator variants
+// The base param and __contains both match on substring
+func TextParamInclude(characteristic string, form url.Values, param string) bool {
+	return All([]bool{
+		MatchAny(characteristic, form[param], containsString),
+		MatchAny(characteristic, form[param+"__contains"], containsString),
+		MatchAny(characteristic, form[param+"__startswith"], hasPrefixString),
+		MatchAnyRegex(characteristic, form[param+"__regex"]),
+		MatchNone(characteristic, form[param+"__not"], containsString),
+		MatchNone(characteristic, form[param+"__ne"], containsString),
+	})
+}
+
+// StringSliceParamInclude checks a []string characteristic against param and all of its operator variants
+// Every requested value must be matched by some element; __not/__ne exclude any element matching any value.
+// The param is compiled on every call; compile a sliceFilter once to check many characteristics
+func StringSliceParamInclude(characteristic []string, form url.Values, param string) bool {
+	filter, err := compileSliceFilter(form, param)
+	return err == nil && filter.matches(characteristic)
+}
+
+// parseIntList parses comma-separated integers such as "1,2,3"
+func parseIntList(value string) ([]int, error) {
+	var ints []int
+	for _, part := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// IntParamInclude checks an int characteristic against param and all of its operator variants
+// The param is compiled on every call; compile an intFilter once to check many characteristics
+func IntParamInclude(characteristic int, form url.Values, param string) (bool, error) {
+	filter, err := compileIntFilter(form, param)
+	if err != nil {
+		return false, err
+	}
+	return filter.matches(characteristic), nil
+}
+
 func SetHeaderDefaults(w *http.ResponseWriter) {
 	(*w).Header().Set("Content-Type", "application/json")
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
@@ -485,14 +983,31 @@ func SetHeaderDefaults(w *http.ResponseWriter) {
 }
 
 func (h *FighterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Get current fighters from DataStore (snapshot at request start)
-	fighters := h.DataStore.GetFighters()
+	// Take one snapshot of the data for the whole request, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+
+	if path := pathParam(r, "/fighters/"); path != "" {
+		id, sub, _ := strings.Cut(path, "/")
+		switch sub {
+		case "":
+			h.serveFighter(w, r, snap, id)
+		case "abilities":
+			h.serveFighterAbilities(w, r, snap, id)
+		default:
+			writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("unknown fighter endpoint '%s'", sub))
+		}
+		return
+	}
+	h.serveFighters(w, r, snap, nil)
+}
 
-	var (
-		response []byte
-		toRet    Fighters
-		wg       sync.WaitGroup
-	)
+// serveFighters handles /fighters, and /abilities/{_id}/fighters with the fighters limited to those that can
+// use the ability
+func (h *FighterHandler) serveFighters(w http.ResponseWriter, r *http.Request, snap *Snapshot, ability *Ability) {
+	// Get current fighters from the request's snapshot
+	fighters := snap.GetFighters()
+
+	var toRet Fighters
 
 	// Step 1: Parse form data
 	if err := r.ParseForm(); err != nil {
@@ -501,69 +1016,204 @@ func (h *FighterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Unfiltered requests are served from the snapshot's pre-encoded body without any encoding work
+	if len(r.Form) == 0 && ability == nil && snap.fighterBody.ok() {
+		log.Printf("returning all %d fighters to %s", len(fighters), r.RemoteAddr)
+		setPageHeaders(w, r, len(fighters), Page{}, snap.Hash)
+		writeEncodedBody(w, r, snap.fighterBody)
+		return
+	}
+
 	// Step 2: Validate all query parameters are recognized
-	if err := validateQueryParams(r.Form, validFighterParams, true); err != nil {
+	if err := validateQueryParams(r.Form, validFighterParams); err != nil {
 		writeErrorJSON(w, http.StatusBadRequest, err.Error())
 		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
 		return
 	}
 
-	// Step 3: Validate all integer parameters have valid values
-	intParams := []string{"movement", "toughness", "wounds", "points",
-		"attacks", "strength", "dmg_hit", "dmg_crit",
-		"min_range", "max_range"}
-	if err := validateIntParams(r.Form, intParams); err != nil {
+	// Step 3: Validate all integer and regex parameters have valid values
+	if err := validateParamValues(r.Form, validFighterParams); err != nil {
 		writeErrorJSON(w, http.StatusBadRequest, err.Error())
 		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
 		return
 	}
 
-	// All validation passed - proceed with filtering
-	fChan := make(chan Fighter, len(fighters))
+	// Step 4: Validate weapon matching modes
+	if err := validateChoiceParam(r.Form, "weapon_match", []string{"any", "all"}); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(r.Form, "weapons", []string{"all", "matched"}); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
 
+	// Step 5: Validate ordering and paging
+	sortKeys, sortErr := parseSort(r.Form["sort"], fighterSortFields)
+	if sortErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, sortErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, sortErr)
+		return
+	}
+	page, pageErr := parsePage(r.Form, snap.Hash)
+	if pageErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, pageErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, pageErr)
+		return
+	}
+
+	// Step 6: Validate field selection and expansion
+	fields, expand, shapeErr := parseFighterShape(r)
+	if shapeErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, shapeErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, shapeErr)
+		return
+	}
+
+	// Step 7: Compile the filters and query expression into a plan
+	plan, planErr := CompileFighterPlan(r.Form)
+	if planErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, planErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, planErr)
+		return
+	}
+
+	// All validation passed - proceed with filtering
 	if len(r.Form) > 0 {
-		// Filter fighters based on validated criteria
-		for i := range fighters {
-			wg.Add(1)
-			index := i
-			go func() {
-				defer wg.Done()
-				fighters[index].MatchesRequest(r, fChan)
-			}()
-		}
-		wg.Wait()
+		// Filter fighters with the compiled plan, keeping data order
+		toRet = plan.Select(snap)
 	} else {
 		// No criteria - return all fighters
 		toRet = append(toRet, fighters...)
 	}
+	if ability != nil {
+		toRet = toRet.CanUse(ability)
+	}
 
-	close(fChan)
-	for includedFighter := range fChan {
-		toRet = append(toRet, includedFighter)
+	// Fuzzy name lookups rank the closest names first unless an explicit order is requested
+	if len(sortKeys) == 0 && len(r.Form["name__fuzzy"]) > 0 {
+		rankByNameSimilarity(toRet, func(f *Fighter) string { return f.Name }, r.Form["name__fuzzy"])
+	}
+	SortFighters(toRet, sortKeys)
+	total := len(toRet)
+	toRet = paginate(toRet, page)
+
+	// Optionally trim each fighter's weapons to those that matched
+	if matchedWeaponsOnly(r) {
+		for i := range toRet {
+			toRet[i].Weapons = plan.MatchingWeapons(&toRet[i])
+		}
 	}
 
-	// Marshal and return results
-	log.Printf("returning %d fighters to %s", len(toRet), r.RemoteAddr)
-	marshalledResponse, err := json.Marshal(toRet)
+	shaped, err := shapeFighters(toRet, fields, expand, snap.GetWarbands())
 	if err != nil {
-		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error marshalling response: %v", err))
-		log.Printf("ERROR: failed to marshal fighters: %s", err)
+		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error shaping response: %v", err))
+		log.Printf("ERROR: failed to shape fighters: %s", err)
 		return
 	}
 
-	response = marshalledResponse
-	SetHeaderDefaults(&w)
-	_, writeErr := w.Write(response)
-	if writeErr != nil {
-		log.Printf("WARNING: failed to write response -- %s", writeErr)
+	// Stream the results
+	log.Printf("returning %d of %d fighters to %s", len(toRet), total, r.RemoteAddr)
+	setPageHeaders(w, r, total, page, snap.Hash)
+	writeJSON(w, shaped)
+}
+
+// serveFighterAbilities handles /fighters/{_id}/abilities, accepting the same parameters as /abilities
+func (h *FighterHandler) serveFighterAbilities(w http.ResponseWriter, r *http.Request, snap *Snapshot, id FighterID) {
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if _, exists := snap.GetFighter(id); !exists {
+		writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("fighter '%s' not found", id))
+		return
+	}
+
+	// usable_by is set on a copy of the form, leaving the caller's request untouched
+	form := make(url.Values, len(r.Form)+1)
+	for param, values := range r.Form {
+		form[param] = values
+	}
+	form["usable_by"] = []string{id}
+	scoped := r.WithContext(r.Context())
+	scoped.Form = form
+
+	abilityHandler := &AbilityHandler{DataStore: h.DataStore}
+	abilityHandler.serveAbilities(w, scoped, snap)
+}
+
+// serveFighter returns a single fighter looked up by _id
+func (h *FighterHandler) serveFighter(w http.ResponseWriter, r *http.Request, snap *Snapshot, id FighterID) {
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	fields, expand, shapeErr := parseFighterShape(r)
+	if shapeErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, shapeErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, shapeErr)
+		return
+	}
+
+	fighter, exists := snap.GetFighter(id)
+	if !exists {
+		writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("fighter '%s' not found", id))
+		return
+	}
+	if len(fields) == 0 && len(expand) == 0 {
+		log.Printf("returning fighter %s to %s", id, r.RemoteAddr)
+		writeJSON(w, fighter)
+		return
+	}
+
+	shaped, err := shapeFighter(&fighter, fields, expand, snap.GetWarbands())
+	if err != nil {
+		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error shaping response: %v", err))
+		log.Printf("ERROR: failed to shape fighter: %s", err)
+		return
+	}
+	log.Printf("returning fighter %s to %s", id, r.RemoteAddr)
+	writeJSON(w, shaped)
+}
+
+// parseFighterShape reads the fields and expand parameters for fighter responses
+func parseFighterShape(r *http.Request) ([]string, []string, error) {
+	fields, err := parseFields(r.Form["fields"], fighterFieldPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	expand, err := parseExpand(r.Form["expand"], validFighterExpansions)
+	if err != nil {
+		return nil, nil, err
 	}
+	return fields, expand, nil
 }
 
 func (h *AbilityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Get current abilities from DataStore (snapshot at request start)
-	abilities := h.DataStore.GetAbilities()
+	// Take one snapshot of the data for the whole request, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+
+	id, sub, _ := strings.Cut(pathParam(r, "/abilities/"), "/")
+	switch {
+	case id == "":
+		h.serveAbilities(w, r, snap)
+	case sub == "":
+		h.serveAbility(w, r, snap, id)
+	case sub == "fighters":
+		h.serveAbilityFighters(w, r, snap, id)
+	default:
+		writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("unknown ability endpoint '%s'", sub))
+	}
+}
 
-	var response []byte
+// serveAbilities handles /abilities, and /fighters/{_id}/abilities with usable_by set to the fighter
+func (h *AbilityHandler) serveAbilities(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	// Get current abilities from the request's snapshot
+	abilities := snap.GetAbilities()
 
 	// Step 1: Parse form data
 	if err := r.ParseForm(); err != nil {
@@ -572,12 +1222,78 @@ func (h *AbilityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Unfiltered requests are served from the snapshot's pre-encoded body without any encoding work
+	if len(r.Form) == 0 && snap.abilityBody.ok() {
+		log.Printf("returning all %d abilities to %s", len(abilities), r.RemoteAddr)
+		setPageHeaders(w, r, len(abilities), Page{}, snap.Hash)
+		writeEncodedBody(w, r, snap.abilityBody)
+		return
+	}
+
 	// Step 2: Validate all query parameters are recognized
-	if err := validateQueryParams(r.Form, validAbilityParams, false); err != nil {
+	if err := validateQueryParams(r.Form, validAbilityParams); err != nil {
 		writeErrorJSON(w, http.StatusBadRequest, err.Error())
 		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
 		return
 	}
+	if err := validateParamValues(r.Form, validAbilityParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(r.Form, "universal", []string{"true", "false"}); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateCostParams(r.Form); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Validate ordering and paging
+	sortKeys, sortErr := parseSort(r.Form["sort"], abilitySortFields)
+	if sortErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, sortErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, sortErr)
+		return
+	}
+	page, pageErr := parsePage(r.Form, snap.Hash)
+	if pageErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, pageErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, pageErr)
+		return
+	}
+
+	// Step 4: Validate field selection
+	fields, fieldsErr := parseFields(r.Form["fields"], abilityFieldPaths)
+	if fieldsErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fieldsErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, fieldsErr)
+		return
+	}
+
+	// Step 5: Parse the query expression
+	query, queryErr := ParseAbilityQuery(r.Form["q"])
+	if queryErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, queryErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, queryErr)
+		return
+	}
+
+	// Step 6: Look up the fighters abilities must be usable by
+	var users Fighters
+	for _, id := range r.Form["usable_by"] {
+		fighter, exists := snap.GetFighter(id)
+		if !exists {
+			err := QueryError{Parameter: "usable_by", Value: id, Reason: "no fighter with this _id"}
+			writeErrorJSON(w, http.StatusBadRequest, err.Error())
+			log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+			return
+		}
+		users = append(users, fighter)
+	}
 
 	// All validation passed - proceed with filtering
 	var toRet Abilities
@@ -591,7 +1307,7 @@ func (h *AbilityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				log.Printf("ERROR: unexpected error from %s: %v", r.RemoteAddr, err)
 				return
 			}
-			if include {
+			if include && query.Matches(&a) && usableByAny(&a, users) {
 				toRet = append(toRet, a)
 			}
 		}
@@ -599,19 +1315,225 @@ func (h *AbilityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		toRet = append(toRet, abilities...)
 	}
 
+	if len(sortKeys) == 0 && len(r.Form["name__fuzzy"]) > 0 {
+		rankByNameSimilarity(toRet, func(a *Ability) string { return a.Name }, r.Form["name__fuzzy"])
+	}
+	SortAbilities(toRet, sortKeys)
+	total := len(toRet)
+	toRet = paginate(toRet, page)
+
+	shaped, err := shapeAbilities(toRet, fields)
+	if err != nil {
+		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error shaping response: %v", err))
+		log.Printf("ERROR: failed to shape abilities: %s", err)
+		return
+	}
+
+	// Stream the results
+	log.Printf("returning %d of %d abilities to %s", len(toRet), total, r.RemoteAddr)
+	setPageHeaders(w, r, total, page, snap.Hash)
+	writeJSON(w, shaped)
+}
+
+func (h *WarbandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get current warbands from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	warbands := snap.GetWarbands()
+
+	// Step 1: Parse form data
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate all query parameters are recognized
+	if err := validateQueryParams(r.Form, validWarbandParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateWarbandExclusions(r.Form["exclude"]); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	for _, param := range []string{"include_universal", "bladeborn"} {
+		if err := validateChoiceParam(r.Form, param, []string{"true", "false"}); err != nil {
+			writeErrorJSON(w, http.StatusBadRequest, err.Error())
+			log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+			return
+		}
+	}
+
+	// Universal abilities are only merged into each warband's abilities on request
+	var universal Abilities
+	if strings.EqualFold(r.Form.Get("include_universal"), "true") {
+		abilities := snap.GetAbilities()
+		universal = abilities.Universal()
+	}
+
+	var toRet any
+
+	if path := pathParam(r, "/warbands/"); path != "" {
+		// Single warband by name, or its subfactions
+		name, sub, _ := strings.Cut(path, "/")
+		warband := warbands.GetWarband(name)
+		if warband == nil {
+			writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("warband '%s' not found", name))
+			return
+		}
+		switch sub {
+		case "":
+			toRet = warband.WithUniversal(universal).Without(r.Form["exclude"])
+		case "subfactions":
+			subfactions := []Subfaction{}
+			for _, s := range warband.Subfactions {
+				if StringParamInclude(strconv.FormatBool(s.Bladeborn), r.Form, "bladeborn") {
+					subfactions = append(subfactions, s.Without(r.Form["exclude"]))
+				}
+			}
+			log.Printf("returning %d subfactions of %s to %s", len(subfactions), warband.Name, r.RemoteAddr)
+			toRet = subfactions
+		default:
+			writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("unknown warband endpoint '%s'", sub))
+			return
+		}
+	} else {
+		matched := Warbands{}
+		for i := range warbands {
+			if warbands[i].MatchesRequest(r) {
+				matched = append(matched, warbands[i].WithUniversal(universal).Without(r.Form["exclude"]))
+			}
+		}
+		log.Printf("returning %d warbands to %s", len(matched), r.RemoteAddr)
+		toRet = matched
+	}
+
 	// Marshal and return results
-	log.Printf("returning %d abilities to %s", len(toRet), r.RemoteAddr)
-	marshalledResponse, err := json.Marshal(toRet)
+	writeJSON(w, toRet)
+}
+
+// usableByAny reports whether any of the fighters can use the ability, or true if there are no fighters to check
+func usableByAny(a *Ability, fighters Fighters) bool {
+	if len(fighters) == 0 {
+		return true
+	}
+	for i := range fighters {
+		if a.UsableBy(&fighters[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveAbilityFighters handles /abilities/{_id}/fighters, listing the fighters that can use the ability and
+// accepting the same parameters as /fighters
+func (h *AbilityHandler) serveAbilityFighters(w http.ResponseWriter, r *http.Request, snap *Snapshot, id AbilityID) {
+	ability, exists := snap.GetAbility(id)
+	if !exists {
+		writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("ability '%s' not found", id))
+		return
+	}
+
+	fighterHandler := &FighterHandler{DataStore: h.DataStore}
+	fighterHandler.serveFighters(w, r, snap, &ability)
+}
+
+// serveAbility returns a single ability looked up by _id
+func (h *AbilityHandler) serveAbility(w http.ResponseWriter, r *http.Request, snap *Snapshot, id AbilityID) {
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	fields, fieldsErr := parseFields(r.Form["fields"], abilityFieldPaths)
+	if fieldsErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fieldsErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, fieldsErr)
+		return
+	}
+
+	ability, exists := snap.GetAbility(id)
+	if !exists {
+		writeErrorJSON(w, http.StatusNotFound, fmt.Sprintf("ability '%s' not found", id))
+		return
+	}
+	if len(fields) == 0 {
+		log.Printf("returning ability %s to %s", id, r.RemoteAddr)
+		writeJSON(w, ability)
+		return
+	}
+
+	obj, err := toObject(&ability)
 	if err != nil {
-		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error marshalling response: %v", err))
-		log.Printf("ERROR: failed to marshal abilities: %s", err)
+		writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error shaping response: %v", err))
+		log.Printf("ERROR: failed to shape ability: %s", err)
 		return
 	}
+	log.Printf("returning ability %s to %s", id, r.RemoteAddr)
+	writeJSON(w, project(obj, fields))
+}
 
-	response = marshalledResponse
-	SetHeaderDefaults(&w)
-	_, writeErr := w.Write(response)
-	if writeErr != nil {
-		log.Printf("WARNING: failed to write response -- %s", writeErr)
+func (h *WeaponHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get current fighters from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	fighters := snap.GetFighters()
+
+	// Step 1: Parse form data
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate all query parameters are recognized and have valid values
+	if err := validateQueryParams(r.Form, validWeaponParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
 	}
+	if err := validateParamValues(r.Form, validWeaponParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Validate ordering and paging
+	sortKeys, sortErr := parseSort(r.Form["sort"], weaponProfileSortFields)
+	if sortErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, sortErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, sortErr)
+		return
+	}
+	page, pageErr := parsePage(r.Form, snap.Hash)
+	if pageErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, pageErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, pageErr)
+		return
+	}
+
+	// All validation passed - proceed with filtering
+	toRet := []WeaponProfile{}
+	for _, p := range fighters.WeaponProfiles() {
+		include, err := p.MatchesRequest(r)
+		if err != nil {
+			// This should not happen with validated input
+			writeErrorJSON(w, http.StatusInternalServerError, fmt.Sprintf("error filtering weapons: %v", err))
+			log.Printf("ERROR: unexpected error from %s: %v", r.RemoteAddr, err)
+			return
+		}
+		if include {
+			toRet = append(toRet, p)
+		}
+	}
+
+	SortWeaponProfiles(toRet, sortKeys)
+	total := len(toRet)
+	toRet = paginate(toRet, page)
+
+	// Marshal and return results
+	log.Printf("returning %d of %d weapons to %s", len(toRet), total, r.RemoteAddr)
+	setPageHeaders(w, r, total, page, snap.Hash)
+	writeJSON(w, toRet)
 }
@@ -0,0 +1,167 @@
+package warscry
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestStringParamInclude(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"no filters", "", true},
+		{"equal", "warband=khorne", true},
+		{"equal ignores case", "warband=KHORNE", true},
+		{"not equal", "warband=stormcast", false},
+		{"any of several values", "warband=stormcast&warband=khorne", true},
+		{"contains", "warband__contains=hor", true},
+		{"does not contain", "warband__contains=storm", false},
+		{"starts with", "warband__startswith=kh", true},
+		{"does not start with", "warband__startswith=orn", false},
+		{"regex", "warband__regex=^k.*e$", true},
+		{"regex ignores case", "warband__regex=^KHO", true},
+		{"regex does not match", "warband__regex=^s", false},
+		{"any of several regexes", "warband__regex=^s&warband__regex=rne$", true},
+		{"invalid regex", "warband__regex=(", false},
+		{"not", "warband__not=stormcast", true},
+		{"not the value", "warband__not=khorne", false},
+		{"not excludes every value", "warband__not=stormcast&warband__not=khorne", false},
+		{"ne", "warband__ne=KHORNE", false},
+		{"every operator must match", "warband__contains=hor&warband__startswith=s", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, _ := url.ParseQuery(tt.query)
+			if got := StringParamInclude("Khorne", form, "warband"); got != tt.want {
+				t.Errorf("StringParamInclude(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringSliceParamInclude(t *testing.T) {
+	runemarks := []string{"hero", "destroyer", "bulwark"}
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"no filters", "", true},
+		{"has value", "runemarks=hero", true},
+		{"value is lower-cased", "runemarks=HERO", true},
+		{"has every value", "runemarks=hero&runemarks=bulwark", true},
+		{"missing one value", "runemarks=hero&runemarks=mount", false},
+		{"contains", "runemarks__contains=stroy", true},
+		{"every contains value", "runemarks__contains=stroy&runemarks__contains=mount", false},
+		{"starts with", "runemarks__startswith=bul", true},
+		{"does not start with", "runemarks__startswith=wark", false},
+		{"regex matches an element", "runemarks__regex=^des.*er$", true},
+		{"regex ignores case", "runemarks__regex=^BULWARK$", true},
+		{"regex matches no element", "runemarks__regex=^mount", false},
+		{"every regex must match an element", "runemarks__regex=^hero$&runemarks__regex=^mount", false},
+		{"regex across elements", "runemarks__regex=hero.destroyer", false},
+		{"invalid regex", "runemarks__regex=[", false},
+		{"not", "runemarks__not=mount", true},
+		{"not any element", "runemarks__not=destroyer", false},
+		{"not ignores case", "runemarks__not=Destroyer", false},
+		{"not excludes every value", "runemarks__not=mount&runemarks__not=bulwark", false},
+		{"ne", "runemarks__ne=hero", false},
+		{"ne and not combine", "runemarks__ne=mount&runemarks__not=beast", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, _ := url.ParseQuery(tt.query)
+			if got := StringSliceParamInclude(runemarks, form, "runemarks"); got != tt.want {
+				t.Errorf("StringSliceParamInclude(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("empty characteristic", func(t *testing.T) {
+		if !StringSliceParamInclude(nil, url.Values{"runemarks__not": {"hero"}}, "runemarks") {
+			t.Error("a fighter without runemarks was excluded by runemarks__not")
+		}
+		if StringSliceParamInclude(nil, url.Values{"runemarks__regex": {".*"}}, "runemarks") {
+			t.Error("a fighter without runemarks matched runemarks__regex")
+		}
+	})
+}
+
+func TestIntParamInclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    bool
+		wantErr bool
+	}{
+		{"no filters", "", true, false},
+		{"equal", "wounds=20", true, false},
+		{"any of several values", "wounds=10&wounds=20", true, false},
+		{"not equal", "wounds=10", false, false},
+		{"greater than", "wounds__gt=19", true, false},
+		{"not greater than", "wounds__gt=20", false, false},
+		{"greater than or equal", "wounds__gte=20", true, false},
+		{"less than", "wounds__lt=20", false, false},
+		{"less than or equal", "wounds__lte=20", true, false},
+		{"range", "wounds__gte=15&wounds__lte=25", true, false},
+		{"empty range", "wounds__gt=20&wounds__lt=30", false, false},
+		{"ne", "wounds__ne=10", true, false},
+		{"ne excludes every value", "wounds__ne=10&wounds__ne=20", false, false},
+		{"in", "wounds__in=10,20,30", true, false},
+		{"not in", "wounds__in=10,30", false, false},
+		{"in merges lists", "wounds__in=10&wounds__in=20", true, false},
+		{"between", "wounds__between=15,20", true, false},
+		{"outside between", "wounds__between=21,30", false, false},
+		{"any between", "wounds__between=1,5&wounds__between=18,22", true, false},
+		{"not an integer", "wounds=lots", false, true},
+		{"invalid in", "wounds__in=10,x", false, true},
+		{"between needs two bounds", "wounds__between=15", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, _ := url.ParseQuery(tt.query)
+			got, err := IntParamInclude(20, form, "wounds")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IntParamInclude(%q) returned error %v, want error %v", tt.query, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IntParamInclude(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextParamInclude(t *testing.T) {
+	const description = "Heal 3 wounds allocated to this fighter."
+
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"no filters", "", true},
+		{"base param matches a substring", "description=HEAL 3", true},
+		{"contains", "description__contains=allocated", true},
+		{"does not contain", "description__contains=damage", false},
+		{"starts with", "description__startswith=heal", true},
+		{"regex", `description__regex=heal \d wounds`, true},
+		{"not excludes substrings", "description__not=wounds", false},
+		{"not", "description__not=damage", true},
+		{"ne excludes substrings", "description__ne=fighter", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, _ := url.ParseQuery(tt.query)
+			if got := TextParamInclude(description, form, "description"); got != tt.want {
+				t.Errorf("TextParamInclude(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
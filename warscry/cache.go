@@ -0,0 +1,139 @@
+package warscry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CachePolicy controls the Cache-Control header sent with successful responses
+type CachePolicy struct {
+	MaxAge  time.Duration // how long clients may reuse a response before revalidating; 0 means always revalidate
+	NoStore bool          // responses must not be stored at all, e.g. health checks
+}
+
+// CacheControl renders the policy as a Cache-Control header value
+func (p CachePolicy) CacheControl() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	if p.MaxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int(p.MaxAge.Seconds()))
+}
+
+// CacheHandler adds validators to GET and HEAD responses of the wrapped handler and answers conditional
+// requests with 304 Not Modified. ETags are derived from the data version and hash, the path and the
+// normalized query, and Last-Modified is the data load time
+type CacheHandler struct {
+	Handler   http.Handler
+	DataStore *DataStore
+	Policy    CachePolicy
+}
+
+// snapshotWriter is a ResponseWriter that pins the snapshot a request is served from
+type snapshotWriter interface {
+	pinnedSnapshot() *Snapshot
+}
+
+// cacheWriter sets validators on the wrapped handler's response once its status is known
+type cacheWriter struct {
+	http.ResponseWriter
+	snap        *Snapshot
+	etag        string
+	policy      CachePolicy
+	wroteHeader bool
+}
+
+func (cw *cacheWriter) pinnedSnapshot() *Snapshot {
+	return cw.snap
+}
+
+// WriteHeader sets validators and Cache-Control on successful responses only; errors are never cached
+func (cw *cacheWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if status == http.StatusOK {
+			setValidators(cw.Header(), cw.snap, cw.etag, cw.policy)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// responseETag identifies one response: the same data, query and content coding always produce the same body
+// Compressed representations get their own ETag since their bytes differ from the uncompressed body
+func responseETag(snap *Snapshot, r *http.Request) string {
+	sum := sha256.Sum256([]byte(snap.Hash + "\n" + r.URL.Path + "?" + r.URL.Query().Encode()))
+	etag := fmt.Sprintf("v%d-%s", snap.Version, hex.EncodeToString(sum[:])[:16])
+	if encoding := negotiateEncoding(r); encoding != "" {
+		etag += "-" + encoding
+	}
+	return `"` + etag + `"`
+}
+
+// setValidators writes the ETag, Last-Modified and Cache-Control headers
+func setValidators(header http.Header, snap *Snapshot, etag string, policy CachePolicy) {
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", snap.LoadedAt.UTC().Format(http.TimeFormat))
+	header.Set("Cache-Control", policy.CacheControl())
+	header.Add("Access-Control-Expose-Headers", "ETag, Last-Modified")
+}
+
+// notModified reports whether the client's cached copy is current: If-None-Match is checked first and,
+// when absent, If-Modified-Since is compared with the data load time
+func notModified(r *http.Request, snap *Snapshot, etag string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !snap.LoadedAt.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+func (h *CacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Only GET and HEAD responses are cacheable
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	if h.Policy.NoStore {
+		w.Header().Set("Cache-Control", h.Policy.CacheControl())
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	// Pin one snapshot so the validators and the wrapped handler's data come from the same load
+	snap := h.DataStore.Snapshot()
+	etag := responseETag(snap, r)
+
+	if notModified(r, snap, etag) {
+		snap.SetHeaders(w)
+		setValidators(w.Header(), snap, etag, h.Policy)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Handler.ServeHTTP(&cacheWriter{ResponseWriter: w, snap: snap, etag: etag, policy: h.Policy}, r)
+}
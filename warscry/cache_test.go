@@ -0,0 +1,50 @@
+package warscry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	loadedAt := time.Date(2024, time.March, 2, 10, 30, 15, 500*int(time.Millisecond), time.UTC)
+	snap := &Snapshot{LoadedAt: loadedAt}
+	const etag = `"v1-0123456789abcdef"`
+
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		want            bool
+	}{
+		{"no validators", "", "", false},
+		{"matching etag", etag, "", true},
+		{"weak etag", "W/" + etag, "", true},
+		{"etag in a list", `"other", ` + etag, "", true},
+		{"any etag", "*", "", true},
+		{"different etag", `"v1-fedcba9876543210"`, "", false},
+		{"unquoted etag", "v1-0123456789abcdef", "", false},
+		{"etag is checked before the date", `"other"`, loadedAt.Add(time.Hour).Format(http.TimeFormat), false},
+		{"matching etag ignores the date", etag, loadedAt.Add(-time.Hour).Format(http.TimeFormat), true},
+		{"modified since", "", loadedAt.Add(-time.Second).Format(http.TimeFormat), false},
+		{"not modified since the load second", "", loadedAt.Format(http.TimeFormat), true},
+		{"not modified since a later date", "", loadedAt.Add(time.Hour).Format(http.TimeFormat), true},
+		{"invalid date", "", "yesterday", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/fighters", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			if got := notModified(r, snap, etag); got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package warscry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Limits on calculator inputs, a little above any profile in the game after modifiers, keeping the
+// exact distributions small enough to compute per request
+const (
+	maxCalculatorAttacks = 20
+	maxCalculatorDamage  = 20
+	maxCalculatorWounds  = 100
+	maxCalculatorActions = 20
+	defaultAttackActions = 3
+	maxRequestBodyBytes  = 1 << 20
+)
+
+// AttackProfile is the weapon characteristics used for an attack, after any modifiers
+type AttackProfile struct {
+	Attacks    int `json:"attacks"`
+	Strength   int `json:"strength"`
+	DamageHit  int `json:"dmg_hit"`
+	DamageCrit int `json:"dmg_crit"`
+}
+
+// TargetProfile is the defending characteristics used for an attack
+type TargetProfile struct {
+	Toughness int `json:"toughness"`
+	Wounds    int `json:"wounds"`
+}
+
+// AttackModifiers are bonuses (or penalties, if negative) applied to an attack profile
+type AttackModifiers struct {
+	Attacks    int `json:"attacks"`
+	Strength   int `json:"strength"`
+	Damage     int `json:"damage"` // applied to both dmg_hit and dmg_crit
+	DamageHit  int `json:"dmg_hit"`
+	DamageCrit int `json:"dmg_crit"`
+}
+
+// NewAttackProfile builds an attack profile from a weapon
+func NewAttackProfile(w *Weapon) AttackProfile {
+	return AttackProfile{
+		Attacks:    w.Attacks.Int(),
+		Strength:   w.Strength.Int(),
+		DamageHit:  w.DamageHit.Int(),
+		DamageCrit: w.DamageCrit.Int(),
+	}
+}
+
+// NewTargetProfile builds a target profile from a fighter
+func NewTargetProfile(f *Fighter) TargetProfile {
+	return TargetProfile{Toughness: f.Toughness.Int(), Wounds: f.Wounds.Int()}
+}
+
+// Apply returns the profile with modifiers added, never dropping a characteristic below zero
+func (p AttackProfile) Apply(m AttackModifiers) AttackProfile {
+	return AttackProfile{
+		Attacks:    max(p.Attacks+m.Attacks, 0),
+		Strength:   max(p.Strength+m.Strength, 0),
+		DamageHit:  max(p.DamageHit+m.Damage+m.DamageHit, 0),
+		DamageCrit: max(p.DamageCrit+m.Damage+m.DamageCrit, 0),
+	}
+}
+
+// Validate checks an attack profile is within the calculator's limits
+func (p AttackProfile) Validate() error {
+	if p.Attacks > maxCalculatorAttacks {
+		return fmt.Errorf("attacks must be at most %d, got %d", maxCalculatorAttacks, p.Attacks)
+	}
+	if p.DamageHit > maxCalculatorDamage || p.DamageCrit > maxCalculatorDamage {
+		return fmt.Errorf("damage must be at most %d, got %d/%d", maxCalculatorDamage, p.DamageHit, p.DamageCrit)
+	}
+	return nil
+}
+
+// Validate checks a target profile is within the calculator's limits
+func (t TargetProfile) Validate() error {
+	if t.Wounds <= 0 || t.Wounds > maxCalculatorWounds {
+		return fmt.Errorf("wounds must be between 1 and %d, got %d", maxCalculatorWounds, t.Wounds)
+	}
+	if t.Toughness < 0 {
+		return fmt.Errorf("toughness must be >= 0, got %d", t.Toughness)
+	}
+	return nil
+}
+
+// HitThreshold returns the dice roll needed to hit: 3+ if strength beats toughness, 5+ if it is lower, otherwise 4+
+// A roll of 6 is always a critical hit
+func HitThreshold(strength int, toughness int) int {
+	switch {
+	case strength > toughness:
+		return 3
+	case strength < toughness:
+		return 5
+	}
+	return 4
+}
+
+// DamageDistribution holds the probability of each total damage, indexed by damage
+type DamageDistribution []float64
+
+// convolve combines two independent damage distributions into the distribution of their sum
+func convolve(a DamageDistribution, b DamageDistribution) DamageDistribution {
+	if len(a) == 0 || len(b) == 0 {
+		return DamageDistribution{}
+	}
+	result := make(DamageDistribution, len(a)+len(b)-1)
+	for i, pa := range a {
+		if pa == 0 {
+			continue
+		}
+		for j, pb := range b {
+			result[i+j] += pa * pb
+		}
+	}
+	return result
+}
+
+// capAt folds all probability of dealing limit or more damage into index limit
+func (d DamageDistribution) capAt(limit int) DamageDistribution {
+	if len(d) <= limit+1 {
+		return d
+	}
+	capped := make(DamageDistribution, limit+1)
+	copy(capped, d[:limit])
+	for _, p := range d[limit:] {
+		capped[limit] += p
+	}
+	return capped
+}
+
+// AttackDistribution returns the exact damage distribution of one attack action against the given toughness
+func AttackDistribution(p AttackProfile, toughness int) DamageDistribution {
+	threshold := HitThreshold(p.Strength, toughness)
+	critChance := 1.0 / 6.0
+	hitChance := float64(6-threshold) / 6.0
+
+	die := make(DamageDistribution, max(p.DamageHit, p.DamageCrit)+1)
+	die[0] += 1 - hitChance - critChance
+	die[p.DamageHit] += hitChance
+	die[p.DamageCrit] += critChance
+
+	dist := DamageDistribution{1}
+	for i := 0; i < p.Attacks; i++ {
+		dist = convolve(dist, die)
+	}
+	return dist
+}
+
+// Expected returns the mean damage of the distribution
+func (d DamageDistribution) Expected() float64 {
+	var expected float64
+	for damage, p := range d {
+		expected += float64(damage) * p
+	}
+	return expected
+}
+
+// AtLeast returns the probability of dealing at least the given damage
+func (d DamageDistribution) AtLeast(damage int) float64 {
+	var total float64
+	for i := max(damage, 0); i < len(d); i++ {
+		total += d[i]
+	}
+	return min(total, 1)
+}
+
+// KillChances returns, for 1..actions attack actions, the probability their combined damage reaches wounds
+func KillChances(d DamageDistribution, wounds int, actions int) []float64 {
+	chances := make([]float64, 0, actions)
+	total := d.capAt(wounds)
+	for n := 1; n <= actions; n++ {
+		if n > 1 {
+			total = convolve(total, d).capAt(wounds)
+		}
+		chances = append(chances, total.AtLeast(wounds))
+	}
+	return chances
+}
+
+// maxActionsToKill bounds ExpectedActionsToKill for attacks that almost never take the target down
+const maxActionsToKill = 200
+
+// ExpectedActionsToKill returns the expected number of attack actions needed for the combined damage to reach wounds
+// Returns false if the attack can never deal damage
+func ExpectedActionsToKill(d DamageDistribution, wounds int) (float64, bool) {
+	if d.AtLeast(1) == 0 {
+		return 0, false
+	}
+
+	// E[N] is the sum over n >= 0 of P(target still standing after n actions)
+	expected := 1.0
+	total := d.capAt(wounds)
+	for n := 1; n < maxActionsToKill; n++ {
+		surviving := 1 - total.AtLeast(wounds)
+		if surviving < 1e-9 {
+			break
+		}
+		expected += surviving
+		total = convolve(total, d).capAt(wounds)
+	}
+	return expected, true
+}
+
+// DamageProbability is the chance of dealing exactly Damage in one attack action
+type DamageProbability struct {
+	Damage      int     `json:"damage"`
+	Probability float64 `json:"probability"`
+}
+
+// KillChance is the chance of taking the target down within Actions attack actions
+type KillChance struct {
+	Actions     int     `json:"actions"`
+	Probability float64 `json:"probability"`
+}
+
+// AttackResult is the outcome of the attack calculator
+type AttackResult struct {
+	Attacker       AttackProfile       `json:"attacker"`
+	Target         TargetProfile       `json:"target"`
+	HitOn          int                 `json:"hit_on"`
+	ExpectedDamage float64             `json:"expected_damage"`
+	Distribution   []DamageProbability `json:"distribution"`
+	KillChances    []KillChance        `json:"kill_chances"`
+}
+
+// CalculateAttack computes the damage distribution of one attack action and the chance to take the target down in up to actions attack actions
+func CalculateAttack(p AttackProfile, t TargetProfile, actions int) AttackResult {
+	dist := AttackDistribution(p, t.Toughness)
+
+	result := AttackResult{
+		Attacker:       p,
+		Target:         t,
+		HitOn:          HitThreshold(p.Strength, t.Toughness),
+		ExpectedDamage: dist.Expected(),
+		Distribution:   []DamageProbability{},
+		KillChances:    []KillChance{},
+	}
+	for damage, probability := range dist {
+		if probability > 0 {
+			result.Distribution = append(result.Distribution, DamageProbability{Damage: damage, Probability: probability})
+		}
+	}
+	for i, probability := range KillChances(dist, t.Wounds, actions) {
+		result.KillChances = append(result.KillChances, KillChance{Actions: i + 1, Probability: probability})
+	}
+	return result
+}
+
+// AttackerSpec selects the attacking weapon, either a fighter's weapon by _id and index or an inline profile
+type AttackerSpec struct {
+	FighterId FighterID      `json:"fighter_id,omitempty"`
+	Weapon    int            `json:"weapon,omitempty"` // index into the fighter's weapons, defaults to the first
+	Profile   *AttackProfile `json:"profile,omitempty"`
+}
+
+// TargetSpec selects the target, either a fighter by _id or inline toughness and wounds
+type TargetSpec struct {
+	FighterId FighterID `json:"fighter_id,omitempty"`
+	Toughness *int      `json:"toughness,omitempty"`
+	Wounds    *int      `json:"wounds,omitempty"`
+}
+
+// AttackRequest is the body of POST /calculate/attack
+type AttackRequest struct {
+	Attacker  AttackerSpec    `json:"attacker"`
+	Target    TargetSpec      `json:"target"`
+	Modifiers AttackModifiers `json:"modifiers"`
+	Actions   int             `json:"actions,omitempty"` // attack actions to report kill chances for, defaults to 3
+}
+
+// ResolveAttacker looks up the attacking profile, before modifiers
+func (s AttackerSpec) ResolveAttacker(snap *Snapshot) (AttackProfile, error) {
+	if s.Profile != nil {
+		if s.FighterId != "" {
+			return AttackProfile{}, errors.New("attacker must have either fighter_id or profile, not both")
+		}
+		return *s.Profile, nil
+	}
+	if s.FighterId == "" {
+		return AttackProfile{}, errors.New("attacker must have either fighter_id or profile")
+	}
+	fighter, exists := snap.GetFighter(s.FighterId)
+	if !exists {
+		return AttackProfile{}, fmt.Errorf("attacking fighter '%s' not found", s.FighterId)
+	}
+	if s.Weapon < 0 || s.Weapon >= len(fighter.Weapons) {
+		return AttackProfile{}, fmt.Errorf("fighter '%s' has no weapon %d", fighter.Name, s.Weapon)
+	}
+	return NewAttackProfile(&fighter.Weapons[s.Weapon]), nil
+}
+
+// ResolveTarget looks up the target profile; inline toughness or wounds override the fighter's
+func (s TargetSpec) ResolveTarget(snap *Snapshot) (TargetProfile, error) {
+	var target TargetProfile
+	if s.FighterId != "" {
+		fighter, exists := snap.GetFighter(s.FighterId)
+		if !exists {
+			return TargetProfile{}, fmt.Errorf("target fighter '%s' not found", s.FighterId)
+		}
+		target = NewTargetProfile(&fighter)
+	} else if s.Toughness == nil || s.Wounds == nil {
+		return TargetProfile{}, errors.New("target must have either fighter_id or both toughness and wounds")
+	}
+	if s.Toughness != nil {
+		target.Toughness = *s.Toughness
+	}
+	if s.Wounds != nil {
+		target.Wounds = *s.Wounds
+	}
+	return target, nil
+}
+
+type CalculatorHandler struct {
+	DataStore *DataStore
+}
+
+// decodeJSONBody decodes a size-limited JSON request body into v, rejecting unknown fields
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("request body must not be empty")
+		}
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// requireMethod writes a 405 error and returns false if the request does not use method
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeErrorJSON(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed, use %s", r.Method, method))
+	return false
+}
+
+func (h *CalculatorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Take one snapshot of the data for the whole request, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Step 1: Parse request body
+	var req AttackRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Resolve and validate attacker and target
+	attacker, attackerErr := req.Attacker.ResolveAttacker(snap)
+	if attackerErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, attackerErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, attackerErr)
+		return
+	}
+	attacker = attacker.Apply(req.Modifiers)
+	target, targetErr := req.Target.ResolveTarget(snap)
+	if targetErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, targetErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, targetErr)
+		return
+	}
+	if err := errors.Join(attacker.Validate(), target.Validate()); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	actions := req.Actions
+	if actions == 0 {
+		actions = defaultAttackActions
+	}
+	if actions < 1 || actions > maxCalculatorActions {
+		err := fmt.Errorf("actions must be between 1 and %d, got %d", maxCalculatorActions, actions)
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Calculate and return results
+	log.Printf("calculating attack for %s", r.RemoteAddr)
+	writeJSON(w, CalculateAttack(attacker, target, actions))
+}
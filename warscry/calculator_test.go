@@ -0,0 +1,152 @@
+package warscry
+
+import (
+	"math"
+	"testing"
+)
+
+// floatsEqual reports whether two probability slices are equal to within rounding
+func floatsEqual(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAttackDistribution(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   AttackProfile
+		toughness int
+		want      DamageDistribution
+	}{
+		{
+			name:      "no attacks",
+			profile:   AttackProfile{Attacks: 0, Strength: 4, DamageHit: 2, DamageCrit: 4},
+			toughness: 4,
+			want:      DamageDistribution{1},
+		},
+		{
+			name:      "strength equals toughness hits on 4+",
+			profile:   AttackProfile{Attacks: 1, Strength: 4, DamageHit: 2, DamageCrit: 5},
+			toughness: 4,
+			want:      DamageDistribution{3.0 / 6, 0, 2.0 / 6, 0, 0, 1.0 / 6},
+		},
+		{
+			name:      "strength above toughness hits on 3+",
+			profile:   AttackProfile{Attacks: 1, Strength: 5, DamageHit: 1, DamageCrit: 3},
+			toughness: 4,
+			want:      DamageDistribution{2.0 / 6, 3.0 / 6, 0, 1.0 / 6},
+		},
+		{
+			name:      "strength below toughness hits on 5+",
+			profile:   AttackProfile{Attacks: 1, Strength: 3, DamageHit: 1, DamageCrit: 3},
+			toughness: 4,
+			want:      DamageDistribution{4.0 / 6, 1.0 / 6, 0, 1.0 / 6},
+		},
+		{
+			name:      "hit and crit deal the same damage",
+			profile:   AttackProfile{Attacks: 1, Strength: 4, DamageHit: 2, DamageCrit: 2},
+			toughness: 4,
+			want:      DamageDistribution{0.5, 0, 0.5},
+		},
+		{
+			name:      "attacks are independent",
+			profile:   AttackProfile{Attacks: 2, Strength: 4, DamageHit: 1, DamageCrit: 2},
+			toughness: 4,
+			want:      DamageDistribution{1.0 / 4, 1.0 / 3, 5.0 / 18, 1.0 / 9, 1.0 / 36},
+		},
+		{
+			name:      "no damage",
+			profile:   AttackProfile{Attacks: 3, Strength: 4, DamageHit: 0, DamageCrit: 0},
+			toughness: 4,
+			want:      DamageDistribution{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AttackDistribution(tt.profile, tt.toughness)
+			if !floatsEqual(got, tt.want) {
+				t.Errorf("AttackDistribution(%+v, %d) = %v, want %v", tt.profile, tt.toughness, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttackDistributionExpected(t *testing.T) {
+	// the mean of the exact distribution matches attacks * (hit chance * dmg_hit + crit chance * dmg_crit)
+	profile := AttackProfile{Attacks: 6, Strength: 5, DamageHit: 2, DamageCrit: 5}
+	dist := AttackDistribution(profile, 3)
+
+	var total float64
+	for _, p := range dist {
+		total += p
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("probabilities sum to %v, want 1", total)
+	}
+	if want := 6 * (3.0/6*2 + 1.0/6*5); math.Abs(dist.Expected()-want) > 1e-9 {
+		t.Errorf("Expected() = %v, want %v", dist.Expected(), want)
+	}
+}
+
+func TestKillChances(t *testing.T) {
+	tests := []struct {
+		name    string
+		dist    DamageDistribution
+		wounds  int
+		actions int
+		want    []float64
+	}{
+		{
+			name:    "no actions",
+			dist:    DamageDistribution{0.5, 0.5},
+			wounds:  1,
+			actions: 0,
+			want:    []float64{},
+		},
+		{
+			name:    "one action can kill",
+			dist:    DamageDistribution{0.5, 0, 1.0 / 3, 0, 0, 1.0 / 6},
+			wounds:  2,
+			actions: 3,
+			want:    []float64{0.5, 0.75, 0.875},
+		},
+		{
+			name:    "damage accumulates over actions",
+			dist:    DamageDistribution{0.5, 0.5},
+			wounds:  2,
+			actions: 3,
+			want:    []float64{0, 0.25, 0.5},
+		},
+		{
+			name:    "overkill counts as a kill",
+			dist:    DamageDistribution{0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+			wounds:  3,
+			actions: 2,
+			want:    []float64{1, 1},
+		},
+		{
+			name:    "never deals damage",
+			dist:    DamageDistribution{1},
+			wounds:  1,
+			actions: 2,
+			want:    []float64{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := KillChances(tt.dist, tt.wounds, tt.actions)
+			if !floatsEqual(got, tt.want) {
+				t.Errorf("KillChances(%v, %d, %d) = %v, want %v", tt.dist, tt.wounds, tt.actions, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package warscry
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content codings negotiated via Accept-Encoding, most preferred first
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+var supportedEncodings = []string{EncodingGzip, EncodingDeflate}
+
+// minCompressSize is the smallest body worth compressing; smaller bodies are sent as they are
+const minCompressSize = 1024
+
+// streamBufferSize is how much of a streamed JSON array is buffered before it is written out
+const streamBufferSize = 32 * 1024
+
+// Compressors are pooled since allocating their state dominates the cost of compressing small responses
+// Dynamic responses use the fastest level; pre-encoded bodies are compressed once with the best
+var (
+	gzipWriters  = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(io.Discard, gzip.BestSpeed); return w }}
+	flateWriters = sync.Pool{New: func() any { w, _ := flate.NewWriter(io.Discard, flate.BestSpeed); return w }}
+)
+
+// negotiateEncoding picks the content coding for a response from the request's Accept-Encoding header,
+// returning "" when the response should not be compressed. q-values are honoured and ties prefer gzip.
+// "*" only stands for codings the header doesn't list, so it never selects one refused with q=0
+func negotiateEncoding(r *http.Request) string {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return ""
+	}
+
+	listed := make(map[string]float64)
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if coding == "*" {
+			wildcard = q
+			continue
+		}
+		listed[coding] = q
+	}
+
+	// supported codings are in order of preference, so the first of equal q-values wins
+	best, bestQ := "", 0.0
+	for _, coding := range supportedEncodings {
+		q, ok := listed[coding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// CompressHandler compresses the wrapped handler's responses with gzip or deflate, as negotiated via
+// Accept-Encoding. Responses that already carry a Content-Encoding, such as pre-encoded bodies, are passed through
+type CompressHandler struct {
+	Handler http.Handler
+}
+
+func (h *CompressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Every response depends on Accept-Encoding, including those sent uncompressed
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	encoding := negotiateEncoding(r)
+	if encoding == "" {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+	defer cw.Close()
+	h.Handler.ServeHTTP(cw, r)
+}
+
+// compressWriter buffers the start of a response and compresses it once it reaches minCompressSize
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	status      int
+	wroteHeader bool
+	passthrough bool // the response is written unchanged
+	buf         []byte
+	compressor  io.WriteCloser
+}
+
+// WriteHeader defers the status until it is known whether the body will be compressed
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	// bodiless and already encoded responses are never compressed
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		cw.Header().Get("Content-Encoding") != "" {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(b)
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= minCompressSize {
+		if err := cw.startCompressing(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// startCompressing sends the headers for a compressed body and writes the buffered start of it
+func (cw *compressWriter) startCompressing() error {
+	cw.Header().Set("Content-Encoding", cw.encoding)
+	cw.Header().Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	switch cw.encoding {
+	case EncodingGzip:
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(cw.ResponseWriter)
+		cw.compressor = gz
+	default:
+		fl := flateWriters.Get().(*flate.Writer)
+		fl.Reset(cw.ResponseWriter)
+		cw.compressor = fl
+	}
+
+	buffered := cw.buf
+	cw.buf = nil
+	_, err := cw.compressor.Write(buffered)
+	return err
+}
+
+// Close finishes the compressed stream, or writes a body too small to compress as it is
+func (cw *compressWriter) Close() {
+	switch {
+	case cw.compressor != nil:
+		if err := cw.compressor.Close(); err != nil {
+			log.Printf("WARNING: failed to finish compressed response -- %s", err)
+		}
+		switch c := cw.compressor.(type) {
+		case *gzip.Writer:
+			gzipWriters.Put(c)
+		case *flate.Writer:
+			flateWriters.Put(c)
+		}
+	case cw.passthrough:
+	case !cw.wroteHeader:
+		// the handler wrote nothing, so the implicit 200 is left to the server
+	default:
+		cw.ResponseWriter.WriteHeader(cw.status)
+		if _, err := cw.ResponseWriter.Write(cw.buf); err != nil {
+			log.Printf("WARNING: failed to write response -- %s", err)
+		}
+	}
+}
+
+// encodedBody is a response marshalled and compressed once per data snapshot
+type encodedBody struct {
+	identity []byte
+	gzip     []byte
+	deflate  []byte
+}
+
+// newEncodedBody marshals v and compresses it with every supported coding at the best compression level
+// On error the body is left empty and requests fall back to encoding their response
+func newEncodedBody(v any) encodedBody {
+	identity, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("WARNING: failed to pre-encode response -- %s", err)
+		return encodedBody{}
+	}
+	body := encodedBody{identity: identity}
+
+	var gz bytes.Buffer
+	gw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if _, err := gw.Write(identity); err == nil && gw.Close() == nil {
+		body.gzip = gz.Bytes()
+	}
+	var fl bytes.Buffer
+	fw, _ := flate.NewWriter(&fl, flate.BestCompression)
+	if _, err := fw.Write(identity); err == nil && fw.Close() == nil {
+		body.deflate = fl.Bytes()
+	}
+	return body
+}
+
+// ok reports whether the body was encoded
+func (b encodedBody) ok() bool {
+	return b.identity != nil
+}
+
+// writeEncodedBody writes a pre-encoded body in the coding negotiated for the request, doing no encoding work
+func writeEncodedBody(w http.ResponseWriter, r *http.Request, body encodedBody) {
+	data, encoding := body.identity, negotiateEncoding(r)
+	switch {
+	case encoding == EncodingGzip && body.gzip != nil:
+		data = body.gzip
+	case encoding == EncodingDeflate && body.deflate != nil:
+		data = body.deflate
+	default:
+		encoding = ""
+	}
+
+	SetHeaderDefaults(&w)
+	if !slices.Contains(w.Header().Values("Vary"), "Accept-Encoding") {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if _, err := w.Write(data); err != nil {
+		log.Printf("WARNING: failed to write response -- %s", err)
+	}
+}
+
+// writeJSONArray streams a slice as a JSON array one element at a time, so large results are never
+// held in memory as a single encoded body. A nil slice is written as null, as json.Marshal would
+func writeJSONArray(w http.ResponseWriter, items reflect.Value) {
+	SetHeaderDefaults(&w)
+	if items.IsNil() {
+		if _, err := w.Write([]byte("null")); err != nil {
+			log.Printf("WARNING: failed to write response -- %s", err)
+		}
+		return
+	}
+
+	out := bufio.NewWriterSize(w, streamBufferSize)
+	var element bytes.Buffer
+	encoder := json.NewEncoder(&element)
+
+	if err := out.WriteByte('['); err != nil {
+		log.Printf("WARNING: failed to write response -- %s", err)
+		return
+	}
+	for i := 0; i < items.Len(); i++ {
+		element.Reset()
+		if err := encoder.Encode(items.Index(i).Addr().Interface()); err != nil {
+			// the status is already sent once any element has been written, so only the first can fail cleanly
+			if i == 0 {
+				writeErrorJSON(w, http.StatusInternalServerError, "error marshalling response: "+err.Error())
+			}
+			log.Printf("ERROR: failed to marshal response element %d: %s", i, err)
+			return
+		}
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		// Encode terminates each value with a newline, which is not part of the array
+		out.Write(bytes.TrimSuffix(element.Bytes(), []byte("\n")))
+	}
+	out.WriteByte(']')
+	if err := out.Flush(); err != nil {
+		log.Printf("WARNING: failed to write response -- %s", err)
+	}
+}
@@ -0,0 +1,47 @@
+package warscry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"gzip", EncodingGzip},
+		{"deflate", EncodingDeflate},
+		{"GZip", EncodingGzip},
+		{"br", ""},
+		{"identity", ""},
+		{"br, deflate", EncodingDeflate},
+		{"deflate, gzip", EncodingGzip},
+		{" gzip ; q=0.9 , deflate;q=0.9", EncodingGzip},
+		{"gzip;q=0.5, deflate", EncodingDeflate},
+		{"br;q=1.0, gzip;q=0.8, deflate;q=0.2", EncodingGzip},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"gzip;q=abc, deflate", EncodingDeflate},
+		{"*", EncodingGzip},
+		{"*;q=0", ""},
+		{"deflate;q=0.9, *", EncodingGzip},
+		{"gzip;q=0, *", EncodingDeflate},
+		{"*, gzip;q=0", EncodingDeflate},
+		{"gzip;q=0, deflate;q=0, *", ""},
+		{"gzip;q=0.5, *;q=0.8", EncodingDeflate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/fighters", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if got := negotiateEncoding(r); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+			}
+		})
+	}
+}
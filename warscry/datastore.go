@@ -1,15 +1,143 @@
 package warscry
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// DataStore holds atomic pointers to current data collections
+// Response headers identifying the data snapshot a response was built from
+const (
+	DataVersionHeader = "X-Data-Version"
+	DataHashHeader    = "X-Data-Hash"
+)
+
+// Snapshot is an immutable, consistent view of every data collection and the indexes and pre-encoded
+// responses derived from it
+// Handlers take one snapshot per request so fighters, abilities and warbands always come from the same load
+type Snapshot struct {
+	Version  uint64    // incremented on every load, 0 before the initial load
+	Hash     string    // first 16 hex digits of the SHA-256 of the fighter and ability data
+	LoadedAt time.Time // when the snapshot was built
+	Source   string    // where the data was loaded from
+
+	fighters      Fighters
+	abilities     Abilities
+	warbands      Warbands
+	fighterIndex  map[FighterID]*Fighter
+	fighterLookup *fighterLookup // fighter positions by _id, warband and runemark, for pruning query plans
+	abilityIndex  map[AbilityID]*Ability
+	searchIndex   *SearchIndex
+	suggestIndex  *SuggestIndex
+	fighterBody   encodedBody // all fighters, served for unfiltered /fighters requests
+	abilityBody   encodedBody // all abilities, served for unfiltered /abilities requests
+}
+
+// NewSnapshot builds a snapshot and its derived indexes from loaded data
+func NewSnapshot(fighters Fighters, abilities Abilities, warbands Warbands, version uint64, source string) *Snapshot {
+	return &Snapshot{
+		Version:       version,
+		Hash:          dataHash(fighters, abilities),
+		LoadedAt:      time.Now().UTC(),
+		Source:        source,
+		fighters:      fighters,
+		abilities:     abilities,
+		warbands:      warbands,
+		fighterIndex:  fighters.IndexById(),
+		fighterLookup: newFighterLookup(fighters),
+		abilityIndex:  abilities.IndexById(),
+		searchIndex:   NewSearchIndex(fighters, abilities),
+		suggestIndex:  NewSuggestIndex(fighters, abilities, warbands),
+		fighterBody:   newEncodedBody(fighters),
+		abilityBody:   newEncodedBody(abilities),
+	}
+}
+
+// emptySnapshot is served before the initial load
+var emptySnapshot = NewSnapshot(Fighters{}, Abilities{}, Warbands{}, 0, "")
+
+// dataHash fingerprints the loaded data; warbands are derived from it so are not hashed separately
+func dataHash(fighters Fighters, abilities Abilities) string {
+	h := sha256.New()
+	for _, v := range []any{fighters, abilities} {
+		if err := json.NewEncoder(h).Encode(v); err != nil {
+			log.Printf("WARNING: failed to hash data -- %s", err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// GetFighters returns the fighter collection
+func (s *Snapshot) GetFighters() Fighters {
+	return s.fighters
+}
+
+// GetAbilities returns the ability collection
+func (s *Snapshot) GetAbilities() Abilities {
+	return s.abilities
+}
+
+// GetWarbands returns the warband collection
+func (s *Snapshot) GetWarbands() Warbands {
+	return s.warbands
+}
+
+// GetVersion returns the snapshot's data version
+func (s *Snapshot) GetVersion() uint64 {
+	return s.Version
+}
+
+// GetFighter returns the fighter with the given _id from the id index
+func (s *Snapshot) GetFighter(id FighterID) (Fighter, bool) {
+	f, exists := s.fighterIndex[id]
+	if !exists {
+		return Fighter{}, false
+	}
+	return *f, true
+}
+
+// GetAbility returns the ability with the given _id from the id index
+func (s *Snapshot) GetAbility(id AbilityID) (Ability, bool) {
+	a, exists := s.abilityIndex[id]
+	if !exists {
+		return Ability{}, false
+	}
+	return *a, true
+}
+
+// GetSearchIndex returns the full-text search index
+func (s *Snapshot) GetSearchIndex() *SearchIndex {
+	return s.searchIndex
+}
+
+// GetSuggestIndex returns the name suggestion index
+func (s *Snapshot) GetSuggestIndex() *SuggestIndex {
+	return s.suggestIndex
+}
+
+// GetCounts returns fighter and ability counts
+func (s *Snapshot) GetCounts() (fighterCount, abilityCount int) {
+	return len(s.fighters), len(s.abilities)
+}
+
+// SetHeaders identifies the snapshot on a response so clients can detect data changes
+func (s *Snapshot) SetHeaders(w http.ResponseWriter) {
+	w.Header().Set(DataVersionHeader, strconv.FormatUint(s.Version, 10))
+	w.Header().Set(DataHashHeader, s.Hash)
+	w.Header().Add("Access-Control-Expose-Headers", DataVersionHeader+", "+DataHashHeader)
+}
+
+// DataStore holds the current snapshot behind a single atomic pointer
 // Thread-safe for concurrent reads and atomic updates
 type DataStore struct {
-	fighters  atomic.Pointer[Fighters]
-	abilities atomic.Pointer[Abilities]
-	warbands  atomic.Pointer[Warbands]
+	snapshot atomic.Pointer[Snapshot]
+	loadLock sync.Mutex // serialises loads so versions increase with every swap
 }
 
 // NewDataStore creates an empty data store
@@ -17,44 +145,41 @@ func NewDataStore() *DataStore {
 	return &DataStore{}
 }
 
-// LoadData atomically replaces all data collections
-// Safe to call while handlers are reading
-func (ds *DataStore) LoadData(fighters *Fighters, abilities *Abilities, warbands *Warbands) {
-	ds.fighters.Store(fighters)
-	ds.abilities.Store(abilities)
-	ds.warbands.Store(warbands)
+// LoadData builds a new snapshot from the given collections and atomically swaps it in
+// Safe to call while handlers are reading; source records where the data came from
+func (ds *DataStore) LoadData(fighters *Fighters, abilities *Abilities, warbands *Warbands, source string) {
+	ds.loadLock.Lock()
+	defer ds.loadLock.Unlock()
+
+	version := ds.Snapshot().Version + 1
+	ds.snapshot.Store(NewSnapshot(*fighters, *abilities, *warbands, version, source))
 }
 
-// GetFighters returns current fighter collection (never nil after initial load)
-func (ds *DataStore) GetFighters() Fighters {
-	ptr := ds.fighters.Load()
-	if ptr == nil {
-		return Fighters{}
+// Snapshot returns the current snapshot (empty before the initial load)
+func (ds *DataStore) Snapshot() *Snapshot {
+	if s := ds.snapshot.Load(); s != nil {
+		return s
 	}
-	return *ptr
+	return emptySnapshot
 }
 
-// GetAbilities returns current ability collection (never nil after initial load)
-func (ds *DataStore) GetAbilities() Abilities {
-	ptr := ds.abilities.Load()
-	if ptr == nil {
-		return Abilities{}
+// SnapshotFor returns the current snapshot, or the one pinned by a wrapping CacheHandler, and identifies
+// it in the response headers. Handlers should call it once per request and read all data from the result
+func (ds *DataStore) SnapshotFor(w http.ResponseWriter) *Snapshot {
+	s := ds.Snapshot()
+	if pinned, ok := w.(snapshotWriter); ok {
+		s = pinned.pinnedSnapshot()
 	}
-	return *ptr
+	s.SetHeaders(w)
+	return s
 }
 
-// GetWarbands returns current warband collection (never nil after initial load)
-func (ds *DataStore) GetWarbands() Warbands {
-	ptr := ds.warbands.Load()
-	if ptr == nil {
-		return Warbands{}
-	}
-	return *ptr
+// GetVersion returns the data version, incremented on every load
+func (ds *DataStore) GetVersion() uint64 {
+	return ds.Snapshot().Version
 }
 
-// GetCounts returns fighter and ability counts
+// GetCounts returns fighter and ability counts of the current snapshot
 func (ds *DataStore) GetCounts() (fighterCount, abilityCount int) {
-	fighters := ds.GetFighters()
-	abilities := ds.GetAbilities()
-	return len(fighters), len(abilities)
+	return ds.Snapshot().GetCounts()
 }
@@ -0,0 +1,244 @@
+package warscry
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Effect keywords recognised in ability descriptions
+const (
+	EffectDamage      = "damage"
+	EffectHeal        = "heal"
+	EffectMove        = "move"
+	EffectDisengage   = "disengage"
+	EffectAttack      = "attack"
+	EffectBonusAction = "bonus_action"
+	EffectModifier    = "modifier"
+	EffectRestriction = "restriction"
+)
+
+// Targets recognised in ability descriptions
+const (
+	TargetSelf     = "self"
+	TargetFriendly = "friendly"
+	TargetEnemy    = "enemy"
+	TargetVisible  = "visible"
+)
+
+// Data quality issue codes reported for descriptions the parser cannot fully read
+const (
+	IssueEmptyDescription    = "empty_description"
+	IssueNoEffects           = "no_effects"
+	IssueDamageWithoutAmount = "damage_without_amount"
+)
+
+// effectPattern matches a keyword or target in a lowercased description
+type effectPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// effectKeywords lists the keywords extracted from descriptions, in the order they are reported
+var effectKeywords = []effectPattern{
+	{EffectDamage, regexp.MustCompile(`\bdamage\b`)},
+	{EffectHeal, regexp.MustCompile(`\bheal`)},
+	{EffectMove, regexp.MustCompile(`\bmoves?\b`)},
+	{EffectDisengage, regexp.MustCompile(`\bdisengage`)},
+	{EffectAttack, regexp.MustCompile(`\battack actions?\b`)},
+	{EffectBonusAction, regexp.MustCompile(`\bbonus (?:move |attack |disengage )?action`)},
+	{EffectModifier, regexp.MustCompile(`\b(?:add|subtract) \d+ (?:to|from)\b`)},
+	{EffectRestriction, regexp.MustCompile(`\bcannot\b|\bcan't\b`)},
+}
+
+// effectTargets lists the targets extracted from descriptions
+var effectTargets = []effectPattern{
+	{TargetSelf, regexp.MustCompile(`\bthis fighter\b`)},
+	{TargetFriendly, regexp.MustCompile(`\bfriendly\b`)},
+	{TargetEnemy, regexp.MustCompile(`\benem(?:y|ies)\b`)},
+	{TargetVisible, regexp.MustCompile(`\bvisible\b`)},
+}
+
+var (
+	distancePattern    = regexp.MustCompile(`(\d+)\s*(?:"|”|″|inch(?:es)?\b)`)
+	damagePattern      = regexp.MustCompile(`(\d+) damage\b|damage(?: points)? equal to (\d+)`)
+	valueOfThisPattern = regexp.MustCompile(`\bvalue of this ability\b`)
+)
+
+// AbilityEffects are the structured facts parsed from an ability description
+type AbilityEffects struct {
+	Keywords  []string `json:"keywords"`
+	Ranges    []int    `json:"ranges,omitempty"`  // distances in inches, e.g. 3 for `within 3"`
+	Damage    []int    `json:"damage,omitempty"`  // fixed damage amounts
+	Targets   []string `json:"targets,omitempty"` // who the ability affects or picks
+	UsesValue bool     `json:"uses_value"`        // refers to "the value of this ability"
+}
+
+// EffectIssue is a part of a description the parser could not turn into effects
+type EffectIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ParseEffects extracts structured effects from an ability description
+// Descriptions are never rejected; anything the parser cannot read is returned as issues
+func ParseEffects(description string) (AbilityEffects, []EffectIssue) {
+	effects := AbilityEffects{Keywords: []string{}}
+	text := strings.ToLower(description)
+
+	if strings.TrimSpace(text) == "" {
+		return effects, []EffectIssue{{Code: IssueEmptyDescription, Message: "description is empty"}}
+	}
+
+	for _, k := range effectKeywords {
+		if k.pattern.MatchString(text) {
+			effects.Keywords = append(effects.Keywords, k.name)
+		}
+	}
+	for _, t := range effectTargets {
+		if t.pattern.MatchString(text) {
+			effects.Targets = append(effects.Targets, t.name)
+		}
+	}
+	effects.Ranges = matchedInts(distancePattern, text)
+	effects.Damage = matchedInts(damagePattern, text)
+	effects.UsesValue = valueOfThisPattern.MatchString(text)
+
+	var issues []EffectIssue
+	if len(effects.Keywords) == 0 {
+		issues = append(issues, EffectIssue{Code: IssueNoEffects, Message: "no recognised effect keywords"})
+	}
+	if slices.Contains(effects.Keywords, EffectDamage) && len(effects.Damage) == 0 && !effects.UsesValue {
+		issues = append(issues, EffectIssue{
+			Code:    IssueDamageWithoutAmount,
+			Message: "mentions damage without a fixed amount or the value of the ability",
+		})
+	}
+	return effects, issues
+}
+
+// matchedInts returns the distinct integers captured by pattern, in order of appearance
+func matchedInts(pattern *regexp.Regexp, text string) []int {
+	var ints []int
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		for _, group := range match[1:] {
+			n, err := strconv.Atoi(group)
+			if err != nil || slices.Contains(ints, n) {
+				continue
+			}
+			ints = append(ints, n)
+		}
+	}
+	return ints
+}
+
+// rangeParamInclude checks the ability's ranges against range and its integer operators
+// An ability matches if any range satisfies every condition; abilities without ranges only match when no range is requested
+func rangeParamInclude(effects *AbilityEffects, form map[string][]string) (bool, error) {
+	if len(effects.Ranges) == 0 {
+		for param := range form {
+			if base, _ := splitOperator(param); base == "range" {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	var conditions []bool
+	for _, distance := range effects.Ranges {
+		include, err := IntParamInclude(distance, form, "range")
+		if err != nil {
+			return false, err
+		}
+		conditions = append(conditions, include)
+	}
+	return Any(conditions), nil
+}
+
+// AbilityIssue is a data quality issue found in a single ability
+type AbilityIssue struct {
+	Id      AbilityID   `json:"_id"`
+	Name    AbilityName `json:"name"`
+	Warband Runemark    `json:"warband"`
+	EffectIssue
+}
+
+// QualityReport lists the abilities whose descriptions could not be fully parsed
+type QualityReport struct {
+	AbilitiesChecked    int            `json:"abilities_checked"`
+	AbilitiesWithIssues int            `json:"abilities_with_issues"`
+	Counts              map[string]int `json:"counts"`
+	Issues              []AbilityIssue `json:"issues"`
+}
+
+// NewQualityReport parses every ability description and collects the issues found
+func NewQualityReport(abilities Abilities) QualityReport {
+	report := QualityReport{
+		AbilitiesChecked: len(abilities),
+		Counts:           make(map[string]int),
+		Issues:           []AbilityIssue{},
+	}
+	for _, a := range abilities {
+		_, issues := ParseEffects(a.Description)
+		if len(issues) > 0 {
+			report.AbilitiesWithIssues++
+		}
+		for _, issue := range issues {
+			report.Counts[issue.Code]++
+			report.Issues = append(report.Issues, AbilityIssue{
+				Id: a.Id, Name: a.Name, Warband: a.FactionRunemark, EffectIssue: issue,
+			})
+		}
+	}
+	return report
+}
+
+// validQualityParams lists all recognized query parameters for /quality endpoint
+var validQualityParams = map[string]fieldKind{
+	"code": controlField,
+}
+
+type QualityHandler struct {
+	DataStore *DataStore
+}
+
+func (h *QualityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get current abilities from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	abilities := snap.GetAbilities()
+
+	// Step 1: Parse form data
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate query parameters
+	if err := validateQueryParams(r.Form, validQualityParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	codes := []string{IssueEmptyDescription, IssueNoEffects, IssueDamageWithoutAmount}
+	if err := validateChoiceParam(r.Form, "code", codes); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Build the report, keeping only the requested issue codes
+	report := NewQualityReport(abilities)
+	if requested := r.Form["code"]; len(requested) > 0 {
+		report.Issues = slices.DeleteFunc(report.Issues, func(i AbilityIssue) bool {
+			return !slices.ContainsFunc(requested, func(code string) bool { return strings.EqualFold(code, i.Code) })
+		})
+	}
+
+	log.Printf("returning %d ability issues to %s", len(report.Issues), r.RemoteAddr)
+	writeJSON(w, report)
+}
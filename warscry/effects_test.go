@@ -0,0 +1,122 @@
+package warscry
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseEffects(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        AbilityEffects
+		issues      []string
+	}{
+		{
+			name:        "empty",
+			description: "  ",
+			want:        AbilityEffects{Keywords: []string{}},
+			issues:      []string{IssueEmptyDescription},
+		},
+		{
+			name:        "bonus move",
+			description: "This fighter makes a bonus move action.",
+			want:        AbilityEffects{Keywords: []string{EffectMove, EffectBonusAction}, Targets: []string{TargetSelf}},
+		},
+		{
+			name:        "damage equal to the value",
+			description: "Pick a visible enemy fighter within 12\" of this fighter. Allocate a number of damage points to that fighter equal to the value of this ability.",
+			want: AbilityEffects{
+				Keywords:  []string{EffectDamage},
+				Ranges:    []int{12},
+				Targets:   []string{TargetSelf, TargetEnemy, TargetVisible},
+				UsesValue: true,
+			},
+		},
+		{
+			name:        "fixed damage",
+			description: "Allocate 3 damage to each enemy fighter within 2\" of this fighter.",
+			want: AbilityEffects{
+				Keywords: []string{EffectDamage},
+				Ranges:   []int{2},
+				Damage:   []int{3},
+				Targets:  []string{TargetSelf, TargetEnemy},
+			},
+		},
+		{
+			name:        "damage points equal to a number",
+			description: "Allocate damage points equal to 4 to a visible enemy fighter.",
+			want: AbilityEffects{
+				Keywords: []string{EffectDamage},
+				Damage:   []int{4},
+				Targets:  []string{TargetEnemy, TargetVisible},
+			},
+		},
+		{
+			name:        "damage without an amount",
+			description: "Enemy fighters take damage when they move.",
+			want:        AbilityEffects{Keywords: []string{EffectDamage, EffectMove}, Targets: []string{TargetEnemy}},
+			issues:      []string{IssueDamageWithoutAmount},
+		},
+		{
+			name:        "heal and distinct ranges",
+			description: "Heal 3 wounds allocated to each friendly fighter within 3\" of this fighter, or within 6 inches if it is a hero, or 3\" again.",
+			want: AbilityEffects{
+				Keywords: []string{EffectHeal},
+				Ranges:   []int{3, 6},
+				Targets:  []string{TargetSelf, TargetFriendly},
+			},
+		},
+		{
+			name:        "disengage and bonus attack",
+			description: "Disengage: this fighter can move up to 3\" and then make a bonus attack action against a visible enemy fighter within 1\".",
+			want: AbilityEffects{
+				Keywords: []string{EffectMove, EffectDisengage, EffectAttack, EffectBonusAction},
+				Ranges:   []int{3, 1},
+				Targets:  []string{TargetSelf, TargetEnemy, TargetVisible},
+			},
+		},
+		{
+			name:        "modifier",
+			description: "Add 1 to the Attacks characteristic of attack actions made by friendly hero fighters.",
+			want:        AbilityEffects{Keywords: []string{EffectAttack, EffectModifier}, Targets: []string{TargetFriendly}},
+		},
+		{
+			name:        "restriction",
+			description: "Until the end of the battle round, this fighter cannot be targeted by enemy fighters that are more than 6” away.",
+			want: AbilityEffects{
+				Keywords: []string{EffectRestriction},
+				Ranges:   []int{6},
+				Targets:  []string{TargetSelf, TargetEnemy},
+			},
+		},
+		{
+			name:        "enemies",
+			description: "Subtract 1 from the Strength of attacks made by enemies.",
+			want:        AbilityEffects{Keywords: []string{EffectModifier}, Targets: []string{TargetEnemy}},
+		},
+		{
+			name:        "no recognised effects",
+			description: "Roll a dice.",
+			want:        AbilityEffects{Keywords: []string{}},
+			issues:      []string{IssueNoEffects},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, issues := ParseEffects(tt.description)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEffects(%q) = %+v, want %+v", tt.description, got, tt.want)
+			}
+			var codes []string
+			for _, issue := range issues {
+				codes = append(codes, issue.Code)
+			}
+			if !slices.Equal(codes, tt.issues) {
+				t.Errorf("ParseEffects(%q) issues = %v, want %v", tt.description, codes, tt.issues)
+			}
+		})
+	}
+}
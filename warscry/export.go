@@ -0,0 +1,327 @@
+package warscry
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// validExportFormats lists the formats a roster can be exported as
+var validExportFormats = []string{"markdown", "text", "tts"}
+
+// validExportParams lists all recognized query parameters for /rosters/export endpoint
+var validExportParams = map[string]fieldKind{
+	"format": controlField,
+}
+
+// RosterExport is a validated roster together with the warband rules that apply to it
+type RosterExport struct {
+	RosterValidation
+	Abilities    Abilities
+	BattleTraits Abilities
+}
+
+// NewRosterExport collects the warband abilities usable by at least one fighter in the roster, and the battle traits
+// of the warband and of the roster's subfaction
+func NewRosterExport(validation RosterValidation, warbands Warbands) RosterExport {
+	export := RosterExport{RosterValidation: validation}
+	warband := warbands.GetWarband(validation.Warband)
+	if warband == nil {
+		return export
+	}
+
+	for i := range warband.Abilities {
+		a := &warband.Abilities[i]
+		for j := range validation.Fighters {
+			if a.UsableBy(&validation.Fighters[j].Fighter) {
+				export.Abilities = append(export.Abilities, *a)
+				break
+			}
+		}
+	}
+	for _, a := range warband.BattleTraits {
+		// a subfaction's battle traits only apply when the whole roster is that subfaction
+		if strings.EqualFold(a.FactionRunemark, warband.Name) ||
+			(validation.Subfaction != "" && strings.EqualFold(a.FactionRunemark, validation.Subfaction)) {
+			export.BattleTraits = append(export.BattleTraits, a)
+		}
+	}
+	return export
+}
+
+// formatRange formats a weapon's range as the profile cards do, e.g. "1" or "3-12"
+func formatRange(w *Weapon) string {
+	if w.MinimumRange.Int() > 0 {
+		return fmt.Sprintf("%d-%d", w.MinimumRange.Int(), w.MaximumRange.Int())
+	}
+	return fmt.Sprintf("%d", w.MaximumRange.Int())
+}
+
+// formatAbilityCost formats an ability cost for display, e.g. "double" becomes "Double"
+func formatAbilityCost(a *Ability) string {
+	cost := strings.ReplaceAll(string(a.Type), "_", " ")
+	if cost == "" {
+		return cost
+	}
+	return strings.ToUpper(cost[:1]) + cost[1:]
+}
+
+// rosterTitle is the heading shared by every export format
+func rosterTitle(e *RosterExport) string {
+	title := e.Warband
+	if e.Subfaction != "" {
+		title = fmt.Sprintf("%s (%s)", title, e.Subfaction)
+	}
+	return fmt.Sprintf("%s - %d/%d points, %d fighters", title, e.Points, e.PointsLimit, e.FighterCount)
+}
+
+// fighterCardText is the plain text profile of a fighter, as used on text exports and TTS cards
+func fighterCardText(f *Fighter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Move %d | Toughness %d | Wounds %d | %d points\n",
+		f.Movement.Int(), f.Toughness.Int(), f.Wounds.Int(), f.Points.Int())
+	if len(f.Runemarks) > 0 {
+		fmt.Fprintf(&b, "Runemarks: %s\n", strings.Join(f.Runemarks, ", "))
+	}
+	for i := range f.Weapons {
+		w := &f.Weapons[i]
+		fmt.Fprintf(&b, "%s: Range %s | Attacks %d | Strength %d | Damage %d/%d\n",
+			w.Runemark, formatRange(w), w.Attacks.Int(), w.Strength.Int(), w.DamageHit.Int(), w.DamageCrit.Int())
+	}
+	return b.String()
+}
+
+// RenderMarkdown renders the roster as a Markdown document
+func (e *RosterExport) RenderMarkdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n## Fighters\n", rosterTitle(e))
+
+	for i := range e.Fighters {
+		rf := &e.Fighters[i]
+		fmt.Fprintf(&b, "\n### %s x%d (%d points each", rf.Name, rf.Count, rf.Points.Int())
+		if rf.Role != RoleWarband {
+			fmt.Fprintf(&b, ", %s", rf.Role)
+		}
+		b.WriteString(")\n\n")
+		if len(rf.Runemarks) > 0 {
+			fmt.Fprintf(&b, "Runemarks: %s\n\n", strings.Join(rf.Runemarks, ", "))
+		}
+		b.WriteString("| Move | Toughness | Wounds |\n| --- | --- | --- |\n")
+		fmt.Fprintf(&b, "| %d | %d | %d |\n\n", rf.Movement.Int(), rf.Toughness.Int(), rf.Wounds.Int())
+		b.WriteString("| Weapon | Range | Attacks | Strength | Damage |\n| --- | --- | --- | --- | --- |\n")
+		for j := range rf.Weapons {
+			w := &rf.Weapons[j]
+			fmt.Fprintf(&b, "| %s | %s | %d | %d | %d/%d |\n",
+				w.Runemark, formatRange(w), w.Attacks.Int(), w.Strength.Int(), w.DamageHit.Int(), w.DamageCrit.Int())
+		}
+	}
+
+	for _, section := range []struct {
+		title     string
+		abilities Abilities
+	}{{"Abilities", e.Abilities}, {"Battle Traits", e.BattleTraits}} {
+		if len(section.abilities) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", section.title)
+		for i := range section.abilities {
+			a := &section.abilities[i]
+			fmt.Fprintf(&b, "- **%s** (%s", a.Name, formatAbilityCost(a))
+			if len(a.Runemarks) > 0 {
+				fmt.Fprintf(&b, "; %s", strings.Join(a.Runemarks, ", "))
+			}
+			fmt.Fprintf(&b, "): %s\n", a.Description)
+		}
+	}
+
+	if !e.Valid {
+		b.WriteString("\n## Rule Violations\n\n")
+		for _, v := range e.Violations {
+			fmt.Fprintf(&b, "- `%s`: %s\n", v.Code, v.Message)
+		}
+	}
+	return b.String()
+}
+
+// RenderText renders the roster as plain text
+func (e *RosterExport) RenderText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", rosterTitle(e))
+
+	for i := range e.Fighters {
+		rf := &e.Fighters[i]
+		fmt.Fprintf(&b, "%dx %s (%d)\n", rf.Count, rf.Name, rf.Points.Int()*rf.Count)
+		for _, line := range strings.Split(strings.TrimSuffix(fighterCardText(&rf.Fighter), "\n"), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+
+	for _, section := range []struct {
+		title     string
+		abilities Abilities
+	}{{"Abilities", e.Abilities}, {"Battle Traits", e.BattleTraits}} {
+		if len(section.abilities) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", section.title)
+		for i := range section.abilities {
+			a := &section.abilities[i]
+			fmt.Fprintf(&b, "- %s [%s]: %s\n", a.Name, formatAbilityCost(a), a.Description)
+		}
+	}
+
+	if !e.Valid {
+		b.WriteString("\nRule violations:\n")
+		for _, v := range e.Violations {
+			fmt.Fprintf(&b, "- %s (%s)\n", v.Message, v.Code)
+		}
+	}
+	return b.String()
+}
+
+// TTSTransform positions an object in a Tabletop Simulator save
+type TTSTransform struct {
+	PosX   float64 `json:"posX"`
+	PosY   float64 `json:"posY"`
+	PosZ   float64 `json:"posZ"`
+	RotX   float64 `json:"rotX"`
+	RotY   float64 `json:"rotY"`
+	RotZ   float64 `json:"rotZ"`
+	ScaleX float64 `json:"scaleX"`
+	ScaleY float64 `json:"scaleY"`
+	ScaleZ float64 `json:"scaleZ"`
+}
+
+// TTSObject is a single object in a Tabletop Simulator save
+type TTSObject struct {
+	Name        string       `json:"Name"`
+	Nickname    string       `json:"Nickname"`
+	Description string       `json:"Description"`
+	GMNotes     string       `json:"GMNotes"`
+	Transform   TTSTransform `json:"Transform"`
+	Locked      bool         `json:"Locked"`
+}
+
+// TTSSave is a Tabletop Simulator saved object file
+type TTSSave struct {
+	SaveName      string      `json:"SaveName"`
+	GameMode      string      `json:"GameMode"`
+	Date          string      `json:"Date"`
+	VersionNumber string      `json:"VersionNumber"`
+	Note          string      `json:"Note"`
+	ObjectStates  []TTSObject `json:"ObjectStates"`
+}
+
+// ttsCardSpacing is the distance between notecards laid out in a row
+const ttsCardSpacing = 3.5
+
+// RenderTTS renders the roster as a Tabletop Simulator saved object, with one notecard per fighter
+// and one for the warband's abilities and battle traits
+func (e *RosterExport) RenderTTS() TTSSave {
+	save := TTSSave{
+		SaveName:     rosterTitle(e),
+		Note:         rosterTitle(e),
+		ObjectStates: []TTSObject{},
+	}
+	card := func(nickname string, description string, gmNotes string) TTSObject {
+		return TTSObject{
+			Name:        "Notecard",
+			Nickname:    nickname,
+			Description: description,
+			GMNotes:     gmNotes,
+			Transform: TTSTransform{
+				PosX: float64(len(save.ObjectStates)) * ttsCardSpacing, PosY: 1, RotY: 180,
+				ScaleX: 1, ScaleY: 1, ScaleZ: 1,
+			},
+		}
+	}
+
+	for i := range e.Fighters {
+		rf := &e.Fighters[i]
+		nickname := rf.Name
+		if rf.Count > 1 {
+			nickname = fmt.Sprintf("%s x%d", rf.Name, rf.Count)
+		}
+		save.ObjectStates = append(save.ObjectStates, card(nickname, fighterCardText(&rf.Fighter), rf.Id))
+	}
+
+	var rules strings.Builder
+	for _, abilities := range []Abilities{e.Abilities, e.BattleTraits} {
+		for i := range abilities {
+			a := &abilities[i]
+			fmt.Fprintf(&rules, "%s [%s]: %s\n\n", a.Name, formatAbilityCost(a), a.Description)
+		}
+	}
+	if rules.Len() > 0 {
+		save.ObjectStates = append(save.ObjectStates, card(e.Warband+" abilities", strings.TrimSpace(rules.String()), e.Warband))
+	}
+	return save
+}
+
+// serveExport handles POST /rosters/export
+func (h *RosterHandler) serveExport(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Step 1: Validate the export format; it is read from the URL only, since ParseForm would consume
+	// the JSON body of a request sent as application/x-www-form-urlencoded
+	query := r.URL.Query()
+	if err := validateQueryParams(query, validExportParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(query, "format", validExportFormats); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Parse request body
+	var roster Roster
+	if err := decodeJSONBody(w, r, &roster); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if roster.PointsLimit < 0 {
+		err := fmt.Errorf("points_limit cannot be negative, got %d", roster.PointsLimit)
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Resolve fighters; broken rules are listed in the export, but unknown fighters can't be exported
+	validation := ValidateRoster(roster, snap, h.rules())
+	if err := validation.ResolveError(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	export := NewRosterExport(validation, snap.GetWarbands())
+
+	// Step 4: Render
+	format := strings.ToLower(query.Get("format"))
+	log.Printf("exporting roster of %d fighters as %s for %s", export.FighterCount, format, r.RemoteAddr)
+	switch format {
+	case "tts":
+		w.Header().Set("Content-Disposition", `attachment; filename="roster.json"`)
+		writeJSON(w, export.RenderTTS())
+		return
+	case "text":
+		writeText(w, "text/plain; charset=utf-8", export.RenderText())
+		return
+	}
+	writeText(w, "text/markdown; charset=utf-8", export.RenderMarkdown())
+}
+
+// writeText writes a successful text response with the given content type
+func writeText(w http.ResponseWriter, contentType string, body string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if _, err := w.Write([]byte(body)); err != nil {
+		log.Printf("WARNING: failed to write text response -- %s", err)
+	}
+}
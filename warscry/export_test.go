@@ -0,0 +1,52 @@
+package warscry
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewRosterExport(t *testing.T) {
+	fighters := Fighters{
+		{Id: "f1", Name: "Mighty Lord of Khorne", FactionRunemark: "khorne", Runemarks: []string{"hero", "leader"}},
+		{Id: "f2", Name: "Bloodreaver", FactionRunemark: "khorne", Runemarks: []string{"berserker"}},
+		{Id: "f3", Name: "Slaughterpriest", FactionRunemark: "khorne", Subfaction: "goretide", Runemarks: []string{"hero", "priest"}},
+	}
+	abilities := Abilities{
+		{Id: "a1", FactionRunemark: "khorne", Type: CostDouble, Runemarks: []string{"berserker"}},
+		{Id: "a2", FactionRunemark: "khorne", Type: CostTriple, Runemarks: []string{"leader"}},
+		{Id: "a3", FactionRunemark: "khorne", Type: CostDouble, Runemarks: []string{"beast"}},
+		{Id: "a4", FactionRunemark: "goretide", Type: CostDouble, Runemarks: []string{"priest"}},
+		{Id: "t1", FactionRunemark: "khorne", Type: CostBattleTrait},
+		{Id: "t2", FactionRunemark: "goretide", Type: CostBattleTrait},
+	}
+	warbands := *LoadWarbands(&fighters, &abilities)
+
+	index := fighters.IndexById()
+	fighter := func(id string) RosterFighter {
+		return RosterFighter{Fighter: *index[id], Count: 1}
+	}
+
+	tests := []struct {
+		name         string
+		validation   RosterValidation
+		abilities    []string
+		battleTraits []string
+	}{
+		{"warband", RosterValidation{Warband: "khorne", Fighters: []RosterFighter{fighter("f1"), fighter("f2")}}, []string{"a1", "a2"}, []string{"t1"}},
+		{"subfaction fighter outside the subfaction", RosterValidation{Warband: "khorne", Fighters: []RosterFighter{fighter("f3")}}, []string{"a4"}, []string{"t1"}},
+		{"subfaction", RosterValidation{Warband: "khorne", Subfaction: "goretide", Fighters: []RosterFighter{fighter("f3")}}, []string{"a4"}, []string{"t1", "t2"}},
+		{"unknown warband", RosterValidation{Warband: "nurgle"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := NewRosterExport(tt.validation, warbands)
+			if got := export.Abilities.GetIds(); !slices.Equal(got, tt.abilities) {
+				t.Errorf("abilities = %v, want %v", got, tt.abilities)
+			}
+			if got := export.BattleTraits.GetIds(); !slices.Equal(got, tt.battleTraits) {
+				t.Errorf("battle traits = %v, want %v", got, tt.battleTraits)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package warscry
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// normalizeName lowercases a name and collapses punctuation and whitespace to single spaces,
+// so "Lord-Celestant" and "lord celestant" compare equal
+func normalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return b.String()
+}
+
+// levenshtein returns the number of single rune insertions, deletions and substitutions turning a into b
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// similarity scores how alike two names are from 0 (nothing in common) to 1 (equal once normalized)
+func similarity(a string, b string) float64 {
+	return normalizedSimilarity(normalizeName(a), normalizeName(b))
+}
+
+// normalizedSimilarity is similarity for names that have already been through normalizeName
+func normalizedSimilarity(na string, nb string) float64 {
+	if na == nb {
+		return 1
+	}
+	longest := max(len([]rune(na)), len([]rune(nb)))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(na, nb))/float64(longest)
+}
+
+// maxFuzzyLength is the most runes a fuzzy query may have; scoring is quadratic in its length and
+// is repeated for every name, so longer queries are rejected rather than scored
+const maxFuzzyLength = 64
+
+// validateFuzzyParam checks every value of a fuzzy name parameter is short enough to score
+func validateFuzzyParam(name string, values []string) error {
+	for _, val := range values {
+		if utf8.RuneCountInString(val) > maxFuzzyLength {
+			return QueryError{
+				Parameter: name,
+				Value:     string([]rune(val)[:32]) + "…",
+				Reason:    fmt.Sprintf("must be at most %d characters", maxFuzzyLength),
+			}
+		}
+	}
+	return nil
+}
+
+// minFuzzySimilarity is the lowest name similarity accepted by name__fuzzy and /suggest
+const minFuzzySimilarity = 0.7
+
+// partialNamePenalty scales the similarity of a match against only some of a name's words,
+// so a whole-name match ranks above a partial one
+const partialNamePenalty = 0.95
+
+// nameSimilarity scores query against name, also trying every run of name's words as long as query,
+// so "celestnt" is close to "Lord-Celestant". Queries longer than maxFuzzyLength match nothing
+func nameSimilarity(query string, name string) float64 {
+	if utf8.RuneCountInString(query) > maxFuzzyLength {
+		return 0
+	}
+	best := similarity(query, name)
+	queryWords := strings.Fields(normalizeName(query))
+	nameWords := strings.Fields(normalizeName(name))
+	if len(queryWords) == 0 || len(queryWords) >= len(nameWords) {
+		return best
+	}
+	for i := 0; i+len(queryWords) <= len(nameWords); i++ {
+		window := strings.Join(nameWords[i:i+len(queryWords)], " ")
+		best = max(best, partialNamePenalty*similarity(query, window))
+	}
+	return best
+}
+
+// bestNameSimilarity returns the highest nameSimilarity of name against any of the queries
+func bestNameSimilarity(queries []string, name string) float64 {
+	var best float64
+	for _, q := range queries {
+		best = max(best, nameSimilarity(q, name))
+	}
+	return best
+}
+
+// rankByNameSimilarity stably orders items by how closely their names match the queries, best first
+func rankByNameSimilarity[T any](items []T, name func(*T) string, queries []string) {
+	scores := make(map[string]float64, len(items))
+	score := func(t *T) float64 {
+		n := name(t)
+		s, seen := scores[n]
+		if !seen {
+			s = bestNameSimilarity(queries, n)
+			scores[n] = s
+		}
+		return s
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		return cmp.Compare(score(&b), score(&a))
+	})
+}
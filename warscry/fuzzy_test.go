@@ -0,0 +1,80 @@
+package warscry
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"liberator", "liberator", 0},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"celestnt", "celestant", 1},
+		// distances count runes, not bytes
+		{"café", "cafe", 1},
+		{"ämbër", "amber", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := levenshtein(tt.a, tt.b); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := levenshtein(tt.b, tt.a); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		value string
+		want  float64
+	}{
+		{"equal once normalized", "lord celestant", "Lord-Celestant", 1},
+		{"whole name typo", "lord celestnt", "Lord-Celestant", 1 - 1.0/14},
+		{"one word window", "celestnt", "Lord-Celestant", partialNamePenalty * (1 - 1.0/9)},
+		{"exact word window", "celestant", "Lord-Celestant", partialNamePenalty},
+		{"two word window", "mighty lrd", "Mighty Lord of Khorne", partialNamePenalty * (1 - 1.0/11)},
+		{"later three word window", "lord of khorn", "Mighty Lord of Khorne", partialNamePenalty * (1 - 1.0/14)},
+		{"window no longer than the query", "lord of", "Mighty Lord of Khorne", partialNamePenalty},
+		{"query with more words than the name", "lord celestant prime", "Lord-Celestant", 1 - 6.0/20},
+		{"empty query", "", "Liberator", 0},
+		{"query too long to score", strings.Repeat("a", maxFuzzyLength+1), strings.Repeat("a", maxFuzzyLength+1), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nameSimilarity(tt.query, tt.value); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("nameSimilarity(%q, %q) = %v, want %v", tt.query, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankByNameSimilarity(t *testing.T) {
+	fighters := Fighters{
+		{Id: "f1", Name: "Liberator"},
+		{Id: "f2", Name: "Lord-Celestant"},
+		{Id: "f3", Name: "Liberator"},
+		{Id: "f4", Name: "Lord-Celestant"},
+	}
+	// each name scores its best match against any query
+	rankByNameSimilarity(fighters, func(f *Fighter) string { return f.Name }, []string{"liberatr", "lord celestant"})
+
+	// the closest names first; fighters scoring the same keep their order
+	if got, want := strings.Join(fighters.GetIds(), ","), "f2,f4,f1,f3"; got != want {
+		t.Errorf("ranked %s, want %s", got, want)
+	}
+}
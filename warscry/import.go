@@ -0,0 +1,354 @@
+package warscry
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Statuses of an imported roster line
+const (
+	ImportMatched   = "matched"
+	ImportAmbiguous = "ambiguous"
+	ImportUnmatched = "unmatched"
+)
+
+// minImportSimilarity is the lowest name similarity accepted as a match
+const minImportSimilarity = 0.7
+
+// ambiguousImportMargin is how close the runner-up must score for a match to be ambiguous
+const ambiguousImportMargin = 0.05
+
+// maxImportCandidates bounds the candidates listed for an ambiguous or unmatched line
+const maxImportCandidates = 3
+
+// maxImportLines bounds the number of fighter lines read from an imported list, well above any real roster;
+// every line is scored against every fighter
+const maxImportLines = 50
+
+// skippedImportSections are list sections that don't contain fighters, e.g. "Abilities:" in /rosters/export text
+var skippedImportSections = []string{"abilities", "battle traits", "rule violations"}
+
+var (
+	// bulletPattern matches list bullets, e.g. "- " or "* "
+	bulletPattern = regexp.MustCompile(`^[-*•+]\s+`)
+	// bracketPointsPattern matches trailing points in brackets, e.g. "(190)" or "[190 pts]"
+	bracketPointsPattern = regexp.MustCompile(`^(.*?)\s*[(\[]\s*(\d+)\s*(?:pts?|points?)?\s*[)\]]$`)
+	// separatedPointsPattern matches trailing points after a separator, e.g. " - 190pts" or ": 190"; dashes need
+	// a space before them so hyphenated names are left alone
+	separatedPointsPattern = regexp.MustCompile(`^(.*?)(?:\s+[-–]|\s*[:|])\s*(\d+)\s*(?:pts?|points?)?$`)
+	// unitPointsPattern matches trailing points with a unit, e.g. "190 pts"
+	unitPointsPattern = regexp.MustCompile(`^(.*?)\s+(\d+)\s*(?:pts?|points?)$`)
+	// prefixCountPattern matches a leading count, e.g. "3x " or "3 "
+	prefixCountPattern = regexp.MustCompile(`^(\d+)\s*[xX×]?\s+(.+)$`)
+	// suffixCountPattern matches a trailing count, e.g. " x3"
+	suffixCountPattern = regexp.MustCompile(`^(.+?)\s*[xX×]\s*(\d+)$`)
+)
+
+// RosterImportRequest is a pasted list to import
+type RosterImportRequest struct {
+	Text        string   `json:"text"`
+	Warband     Runemark `json:"warband,omitempty"`      // detected from the list if empty
+	PointsLimit int      `json:"points_limit,omitempty"` // defaults to the rules' points limit
+}
+
+// ImportCandidate is a fighter a list line might refer to
+type ImportCandidate struct {
+	Id      FighterID   `json:"_id"`
+	Name    FighterName `json:"name"`
+	Warband Runemark    `json:"warband"`
+	Score   float64     `json:"score"`
+}
+
+// ImportLine reports how one fighter line of an imported list was resolved
+type ImportLine struct {
+	Line           int               `json:"line"`
+	Text           string            `json:"text"`
+	Status         string            `json:"status"`
+	FighterId      FighterID         `json:"fighter_id,omitempty"`
+	Name           FighterName       `json:"name,omitempty"`
+	Count          int               `json:"count"`
+	Score          float64           `json:"score,omitempty"`
+	ListedPoints   *int              `json:"listed_points,omitempty"`
+	CurrentPoints  int               `json:"current_points,omitempty"`
+	PointsMismatch bool              `json:"points_mismatch"`
+	Candidates     []ImportCandidate `json:"candidates,omitempty"`
+}
+
+// RosterImport is an imported list resolved into a roster, with a report of every fighter line
+type RosterImport struct {
+	Warband    Runemark         `json:"warband"`
+	Roster     Roster           `json:"roster"`
+	Validation RosterValidation `json:"validation"`
+	Lines      []ImportLine     `json:"lines"`
+}
+
+// listLine is a fighter line parsed from an imported list
+type listLine struct {
+	number int
+	text   string
+	name   string
+	count  int
+	points *int
+}
+
+// parseListLine extracts the fighter name, count and listed points from a line such as "3x Liberator (285)"
+func parseListLine(number int, text string) listLine {
+	line := listLine{number: number, text: text, count: 1}
+	rest := bulletPattern.ReplaceAllString(strings.TrimSpace(text), "")
+
+	for _, pattern := range []*regexp.Regexp{bracketPointsPattern, separatedPointsPattern, unitPointsPattern} {
+		if m := pattern.FindStringSubmatch(rest); m != nil {
+			points, _ := strconv.Atoi(m[2])
+			line.points = &points
+			rest = m[1]
+			break
+		}
+	}
+	if m := prefixCountPattern.FindStringSubmatch(rest); m != nil {
+		line.count, _ = strconv.Atoi(m[1])
+		rest = m[2]
+	} else if m := suffixCountPattern.FindStringSubmatch(rest); m != nil {
+		line.count, _ = strconv.Atoi(m[2])
+		rest = m[1]
+	}
+	line.name = strings.TrimSpace(rest)
+	return line
+}
+
+// headerWarband returns the warband a list heading names, e.g. "Stormcast Eternals - 995 pts", or nil
+func headerWarband(text string, warbands Warbands) *Warband {
+	heading := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(text), "#"))
+	for _, sep := range []string{" - ", " (", " [", ":"} {
+		heading, _, _ = strings.Cut(heading, sep)
+	}
+	heading = normalizeName(heading)
+	for i := range warbands {
+		if heading != "" && normalizeName(warbands[i].Name) == heading {
+			return &warbands[i]
+		}
+	}
+	return nil
+}
+
+// splitList reads the fighter lines of a pasted list, returning any warband named in a heading. Blank and
+// indented lines, section headings ending in ":" and the contents of non-fighter sections are skipped.
+func splitList(text string, warbands Warbands) ([]listLine, *Warband) {
+	var lines []listLine
+	var heading *Warband
+	skipping := false
+
+	for i, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || strings.IndexFunc(trimmed, unicode.IsLetter) < 0 || raw[0] == ' ' || raw[0] == '\t' {
+			continue
+		}
+		if wb := headerWarband(trimmed, warbands); wb != nil {
+			if heading == nil {
+				heading = wb
+			}
+			continue
+		}
+		if strings.HasSuffix(trimmed, ":") {
+			skipping = slices.Contains(skippedImportSections, normalizeName(trimmed))
+			continue
+		}
+		if skipping || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines = append(lines, parseListLine(i+1, raw))
+	}
+	return lines, heading
+}
+
+// rankCandidates scores every fighter in the pool against name, best first, keeping those similar enough to match.
+// names holds the normalized name of each fighter in the pool. Names longer than maxFuzzyLength are not scored,
+// so their lines are reported unmatched
+func rankCandidates(name string, pool Fighters, names []string) []ImportCandidate {
+	if utf8.RuneCountInString(name) > maxFuzzyLength {
+		return nil
+	}
+	normalized := normalizeName(name)
+	var candidates []ImportCandidate
+	for i := range pool {
+		score := normalizedSimilarity(normalized, names[i])
+		if score >= minImportSimilarity {
+			candidates = append(candidates, ImportCandidate{
+				Id:      pool[i].Id,
+				Name:    pool[i].Name,
+				Warband: pool[i].FactionRunemark,
+				Score:   score,
+			})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b ImportCandidate) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return candidates
+}
+
+// isAmbiguous reports whether the runner-up is too close to the best candidate to pick one; an exact name
+// match is only ambiguous if another fighter has the same name
+func isAmbiguous(candidates []ImportCandidate) bool {
+	if len(candidates) < 2 {
+		return false
+	}
+	if candidates[0].Score == 1 {
+		return candidates[1].Score == 1
+	}
+	return candidates[1].Score >= candidates[0].Score-ambiguousImportMargin
+}
+
+// detectWarband picks the faction most fighter lines clearly match, in order of first appearance on ties,
+// from the candidates of each line among all fighters
+func detectWarband(ranked [][]ImportCandidate) Runemark {
+	var order []Runemark
+	votes := make(map[Runemark]int)
+	for _, candidates := range ranked {
+		if len(candidates) == 0 || isAmbiguous(candidates) {
+			continue
+		}
+		faction := candidates[0].Warband
+		if votes[faction] == 0 {
+			order = append(order, faction)
+		}
+		votes[faction]++
+	}
+
+	var detected Runemark
+	for _, faction := range order {
+		if votes[faction] > votes[detected] {
+			detected = faction
+		}
+	}
+	return detected
+}
+
+// ImportRoster resolves a pasted list into a roster, matching fighter names within the warband, or among
+// allies and thralls of any warband for names that don't match a warband fighter
+func ImportRoster(req RosterImportRequest, snap *Snapshot, rules RosterRules) RosterImport {
+	fighters := snap.GetFighters()
+	warbands := snap.GetWarbands()
+	lines, heading := splitList(req.Text, warbands)
+	if len(lines) > maxImportLines {
+		lines = lines[:maxImportLines]
+	}
+
+	// every line is scored against all fighters once; the warband and allied candidates are filtered from these
+	names := make([]string, len(fighters))
+	for i := range fighters {
+		names[i] = normalizeName(fighters[i].Name)
+	}
+	ranked := make([][]ImportCandidate, len(lines))
+	for i := range lines {
+		ranked[i] = rankCandidates(lines[i].name, fighters, names)
+	}
+
+	// Step 1: Detect the warband from the request, a heading, or the fighters listed
+	result := RosterImport{Warband: req.Warband, Lines: []ImportLine{}}
+	switch {
+	case result.Warband != "":
+		if wb := warbands.GetWarband(result.Warband); wb != nil {
+			result.Warband = wb.Name
+		}
+	case heading != nil:
+		result.Warband = heading.Name
+	default:
+		result.Warband = detectWarband(ranked)
+	}
+
+	allied := make(map[FighterID]bool)
+	for i := range fighters {
+		if !strings.EqualFold(fighters[i].FactionRunemark, result.Warband) && fighters[i].RosterRole() != RoleWarband {
+			allied[fighters[i].Id] = true
+		}
+	}
+
+	// Step 2: Match each line
+	result.Roster = Roster{Warband: result.Warband, PointsLimit: req.PointsLimit, Fighters: []RosterEntry{}}
+	for i, line := range lines {
+		report := ImportLine{Line: line.number, Text: line.text, Count: line.count, ListedPoints: line.points}
+
+		candidates := slices.DeleteFunc(slices.Clone(ranked[i]), func(c ImportCandidate) bool {
+			return !strings.EqualFold(c.Warband, result.Warband)
+		})
+		if len(candidates) == 0 {
+			candidates = slices.DeleteFunc(slices.Clone(ranked[i]), func(c ImportCandidate) bool {
+				return !allied[c.Id]
+			})
+		}
+		switch {
+		case len(candidates) == 0:
+			// fighters from other warbands are suggested, but never matched
+			report.Status = ImportUnmatched
+			if others := ranked[i]; len(others) > 0 {
+				report.Candidates = others[:min(len(others), maxImportCandidates)]
+			}
+		case isAmbiguous(candidates):
+			report.Status = ImportAmbiguous
+			report.Candidates = candidates[:min(len(candidates), maxImportCandidates)]
+		default:
+			best := candidates[0]
+			fighter, _ := snap.GetFighter(best.Id)
+			report.Status = ImportMatched
+			report.FighterId = best.Id
+			report.Name = best.Name
+			report.Score = best.Score
+			report.CurrentPoints = fighter.Points.Int()
+			// listed points may be per fighter or for the whole line
+			if line.points != nil && *line.points != fighter.Points.Int() && *line.points != fighter.Points.Int()*line.count {
+				report.PointsMismatch = true
+			}
+			result.Roster.Fighters = append(result.Roster.Fighters, RosterEntry{FighterId: best.Id, Count: line.count})
+		}
+		result.Lines = append(result.Lines, report)
+	}
+
+	// Step 3: Validate the resolved roster
+	result.Validation = ValidateRoster(result.Roster, snap, rules)
+	return result
+}
+
+// serveImport handles POST /rosters/import
+func (h *RosterHandler) serveImport(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Step 1: Parse request body
+	var req RosterImportRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeErrorJSON(w, http.StatusBadRequest, "text must not be empty")
+		log.Printf("Bad request from %s: empty roster import", r.RemoteAddr)
+		return
+	}
+	if req.PointsLimit < 0 {
+		err := fmt.Errorf("points_limit cannot be negative, got %d", req.PointsLimit)
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Resolve the list and report each line
+	result := ImportRoster(req, snap, h.rules())
+	log.Printf("imported roster of %d lines for %s", len(result.Lines), r.RemoteAddr)
+	writeJSON(w, result)
+}
@@ -0,0 +1,150 @@
+package warscry
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseListLine(t *testing.T) {
+	tests := []struct {
+		text   string
+		name   string
+		count  int
+		points int // 0 when the line lists no points
+	}{
+		{"Liberator", "Liberator", 1, 0},
+		{"  Lord-Celestant  ", "Lord-Celestant", 1, 0},
+		// counts
+		{"3x Liberator", "Liberator", 3, 0},
+		{"3 X Liberator", "Liberator", 3, 0},
+		{"3 Liberator", "Liberator", 3, 0},
+		{"Liberator x3", "Liberator", 3, 0},
+		{"Liberator ×2", "Liberator", 2, 0},
+		// points
+		{"Liberator (95)", "Liberator", 1, 95},
+		{"Liberator [95 pts]", "Liberator", 1, 95},
+		{"Liberator (95 points)", "Liberator", 1, 95},
+		{"Liberator - 95pts", "Liberator", 1, 95},
+		{"Liberator – 95", "Liberator", 1, 95},
+		{"Liberator: 95", "Liberator", 1, 95},
+		{"Liberator | 95 points", "Liberator", 1, 95},
+		{"Liberator 95 pts", "Liberator", 1, 95},
+		{"Mighty Lord of Khorne - 200", "Mighty Lord of Khorne", 1, 200},
+		// a bare trailing number is part of the name, not points
+		{"Liberator 95", "Liberator 95", 1, 0},
+		// bullets, counts and points together
+		{"- 2x Liberator (190)", "Liberator", 2, 190},
+		{"* Liberator x2 [190pts]", "Liberator", 2, 190},
+		{"• 3 Prosecutor - 450", "Prosecutor", 3, 450},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			line := parseListLine(7, tt.text)
+			if line.number != 7 || line.text != tt.text {
+				t.Errorf("line %d %q, want 7 %q", line.number, line.text, tt.text)
+			}
+			if line.name != tt.name || line.count != tt.count {
+				t.Errorf("parsed %q x%d, want %q x%d", line.name, line.count, tt.name, tt.count)
+			}
+			switch {
+			case tt.points == 0 && line.points != nil:
+				t.Errorf("parsed points %d, want none", *line.points)
+			case tt.points != 0 && (line.points == nil || *line.points != tt.points):
+				t.Errorf("parsed points %v, want %d", line.points, tt.points)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	warbands := rosterTestSnapshot().GetWarbands()
+	text := strings.Join([]string{
+		"# Khorne - 1000 pts",
+		"",
+		"Fighters:",
+		"Mighty Lord of Khorne (200)",
+		"  weapons and notes are indented",
+		"\tso are tabs",
+		"2x Bloodreaver\r",
+		"---",
+		"Stormcast Eternals - 500 pts",
+		"Abilities:",
+		"Blood Rage",
+		"Battle Traits:",
+		"Rule Violations:",
+		"too many leaders",
+		"Allies:",
+		"Chaos Troll",
+	}, "\n")
+
+	lines, heading := splitList(text, warbands)
+	if heading == nil || heading.Name != "khorne" {
+		t.Errorf("heading warband = %v, want khorne", heading)
+	}
+	var got []string
+	for _, line := range lines {
+		got = append(got, fmt.Sprintf("%d:%s", line.number, line.name))
+	}
+	want := []string{"4:Mighty Lord of Khorne", "7:Bloodreaver", "16:Chaos Troll"}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitList lines = %v, want %v", got, want)
+	}
+
+	if _, heading := splitList("Liberator\nProsecutor", warbands); heading != nil {
+		t.Errorf("heading warband = %s, want none", heading.Name)
+	}
+}
+
+func TestImportRoster(t *testing.T) {
+	snap := rosterTestSnapshot()
+	text := strings.Join([]string{
+		"Lord Celestant",
+		"2x Liberator (190)",
+		"Prosecuter - 100",
+		"Chaos Trol",
+		"Bloodreaver",
+	}, "\n")
+
+	result := ImportRoster(RosterImportRequest{Text: text}, snap, DefaultRosterRules)
+	if result.Warband != "stormcast-eternals" {
+		t.Errorf("detected warband %q, want stormcast-eternals", result.Warband)
+	}
+
+	var got []string
+	for _, line := range result.Lines {
+		got = append(got, fmt.Sprintf("%s:%s:%d:%v", line.Status, line.FighterId, line.Count, line.PointsMismatch))
+	}
+	want := []string{
+		ImportMatched + ":f1:1:false",
+		ImportMatched + ":f2:2:false", // listed points are for the whole line
+		ImportMatched + ":f3:1:true",
+		ImportMatched + ":f9:1:false", // thralls of any warband can join
+		ImportUnmatched + "::1:false", // fighters of other warbands are never matched
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+	if candidates := result.Lines[4].Candidates; len(candidates) == 0 || candidates[0].Id != "f4" {
+		t.Errorf("unmatched line candidates = %v, want f4 first", candidates)
+	}
+	if len(result.Roster.Fighters) != 4 {
+		t.Errorf("roster has %d entries, want 4", len(result.Roster.Fighters))
+	}
+
+	// a requested warband is used over the fighters listed, and resolved case-insensitively
+	result = ImportRoster(RosterImportRequest{Text: text, Warband: "KHORNE"}, snap, DefaultRosterRules)
+	if result.Warband != "khorne" || result.Lines[4].FighterId != "f4" || result.Lines[0].Status != ImportUnmatched {
+		t.Errorf("importing as khorne resolved %q with lines %+v", result.Warband, result.Lines)
+	}
+}
+
+func TestImportRosterLineLimit(t *testing.T) {
+	text := strings.Repeat("Liberator\n", maxImportLines+10)
+	result := ImportRoster(RosterImportRequest{Text: text}, rosterTestSnapshot(), DefaultRosterRules)
+	if len(result.Lines) != maxImportLines {
+		t.Errorf("imported %d lines, want %d", len(result.Lines), maxImportLines)
+	}
+}
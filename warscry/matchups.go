@@ -0,0 +1,323 @@
+package warscry
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxMatchupPairs bounds the size of a matchup matrix computed per request
+const maxMatchupPairs = 10000
+
+// maxCachedMatchups bounds the number of matchup results cached per data version
+const maxCachedMatchups = 128
+
+// matchupSides are the prefixes selecting attackers and targets with /fighters filters, e.g. attacker.warband=khorne
+var matchupSides = []string{"attacker", "target"}
+
+// validMatchupParams lists the non-prefixed query parameters for /matchups endpoint
+var validMatchupParams = map[string]fieldKind{
+	"format": controlField, "metric": controlField,
+}
+
+// validMatchupMetrics lists the values a CSV matchup matrix can report
+var validMatchupMetrics = []string{"expected_damage", "actions_to_kill", "kill_chance"}
+
+// matchupFilterParams lists the /fighters filters usable to select attackers and targets
+var matchupFilterParams = func() map[string]fieldKind {
+	params := make(map[string]fieldKind)
+	for param, kind := range validFighterParams {
+		if kind != controlField || param == "q" || param == "weapon_match" {
+			params[param] = kind
+		}
+	}
+	return params
+}()
+
+// MatchupFighter identifies a fighter in a matchup matrix
+type MatchupFighter struct {
+	Id        FighterID   `json:"_id"`
+	Name      FighterName `json:"name"`
+	Warband   Runemark    `json:"warband"`
+	Toughness int         `json:"toughness"`
+	Wounds    int         `json:"wounds"`
+}
+
+// Matchup is one attacker's best weapon against one target
+type Matchup struct {
+	Weapon         int      `json:"weapon"`
+	WeaponRunemark Runemark `json:"weapon_runemark"`
+	ExpectedDamage float64  `json:"expected_damage"`
+	ActionsToKill  *float64 `json:"actions_to_kill"` // expected attack actions to take the target down, null if it can't be damaged
+	KillChance     float64  `json:"kill_chance"`     // chance to take the target down with a single attack action
+}
+
+// MatchupResult is a matrix of attackers (rows) against targets (columns)
+type MatchupResult struct {
+	Version   uint64           `json:"version"`
+	Attackers []MatchupFighter `json:"attackers"`
+	Targets   []MatchupFighter `json:"targets"`
+	Matrix    [][]Matchup      `json:"matrix"`
+}
+
+func newMatchupFighter(f *Fighter) MatchupFighter {
+	return MatchupFighter{
+		Id:        f.Id,
+		Name:      f.Name,
+		Warband:   f.FactionRunemark,
+		Toughness: f.Toughness.Int(),
+		Wounds:    f.Wounds.Int(),
+	}
+}
+
+// BestMatchup picks the attacker's weapon with the highest expected damage against the target
+func BestMatchup(attacker *Fighter, target *Fighter) Matchup {
+	best := Matchup{Weapon: -1}
+	targetProfile := NewTargetProfile(target)
+
+	for i := range attacker.Weapons {
+		dist := AttackDistribution(NewAttackProfile(&attacker.Weapons[i]), targetProfile.Toughness)
+		expected := dist.Expected()
+		if best.Weapon >= 0 && expected <= best.ExpectedDamage {
+			continue
+		}
+		best = Matchup{
+			Weapon:         i,
+			WeaponRunemark: attacker.Weapons[i].Runemark,
+			ExpectedDamage: expected,
+			KillChance:     dist.AtLeast(targetProfile.Wounds),
+		}
+		if actions, ok := ExpectedActionsToKill(dist, targetProfile.Wounds); ok {
+			best.ActionsToKill = &actions
+		}
+	}
+	return best
+}
+
+// CalculateMatchups computes the matchup matrix concurrently, one attacker row per task
+func CalculateMatchups(attackers Fighters, targets Fighters) [][]Matchup {
+	matrix := make([][]Matchup, len(attackers))
+	rows := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				row := make([]Matchup, len(targets))
+				for j := range targets {
+					row[j] = BestMatchup(&attackers[i], &targets[j])
+				}
+				matrix[i] = row
+			}
+		}()
+	}
+	for i := range attackers {
+		rows <- i
+	}
+	close(rows)
+	wg.Wait()
+
+	return matrix
+}
+
+// sideForm extracts the /fighters filters for one side of the matchup, e.g. attacker.warband becomes warband
+func sideForm(form url.Values, side string) url.Values {
+	sub := url.Values{}
+	for param, values := range form {
+		if name, found := strings.CutPrefix(param, side+"."); found {
+			sub[name] = values
+		}
+	}
+	return sub
+}
+
+// selectFighters returns the snapshot's fighters matching /fighters filters, validating them first
+func selectFighters(snap *Snapshot, form url.Values) (Fighters, error) {
+	if err := validateQueryParams(form, matchupFilterParams); err != nil {
+		return nil, err
+	}
+	if err := validateParamValues(form, matchupFilterParams); err != nil {
+		return nil, err
+	}
+	if err := validateChoiceParam(form, "weapon_match", []string{"any", "all"}); err != nil {
+		return nil, err
+	}
+	plan, err := CompileFighterPlan(form)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := plan.Select(snap)
+	if selected == nil {
+		selected = Fighters{}
+	}
+	return selected, nil
+}
+
+type MatchupHandler struct {
+	DataStore *DataStore
+
+	cacheLock    sync.Mutex
+	cacheVersion uint64
+	cache        map[string]*MatchupResult
+}
+
+// cached returns a previously computed result for this data version and query
+func (h *MatchupHandler) cached(version uint64, key string) (*MatchupResult, bool) {
+	h.cacheLock.Lock()
+	defer h.cacheLock.Unlock()
+	if h.cacheVersion != version {
+		return nil, false
+	}
+	result, exists := h.cache[key]
+	return result, exists
+}
+
+// store caches a result, discarding results from older data versions
+func (h *MatchupHandler) store(version uint64, key string, result *MatchupResult) {
+	h.cacheLock.Lock()
+	defer h.cacheLock.Unlock()
+	if h.cacheVersion != version || h.cache == nil || len(h.cache) >= maxCachedMatchups {
+		h.cache = make(map[string]*MatchupResult)
+		h.cacheVersion = version
+	}
+	h.cache[key] = result
+}
+
+func (h *MatchupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get current fighters from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	version := snap.GetVersion()
+
+	// Step 1: Parse form data
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate output options; every other parameter must belong to a side
+	options := url.Values{}
+	for param, values := range r.Form {
+		if !strings.HasPrefix(param, "attacker.") && !strings.HasPrefix(param, "target.") {
+			options[param] = values
+		}
+	}
+	if err := validateQueryParams(options, validMatchupParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(r.Form, "format", []string{"json", "csv"}); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(r.Form, "metric", validMatchupMetrics); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Select attackers and targets, or reuse a cached result for the same selection
+	selection := url.Values{}
+	for _, side := range matchupSides {
+		for param, values := range sideForm(r.Form, side) {
+			selection[side+"."+param] = values
+		}
+	}
+	key := selection.Encode()
+
+	result, cached := h.cached(version, key)
+	if !cached {
+		var sides [2]Fighters
+		for i, side := range matchupSides {
+			selected, err := selectFighters(snap, sideForm(r.Form, side))
+			if err != nil {
+				writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("%s filters: %v", side, err))
+				log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+				return
+			}
+			sides[i] = selected
+		}
+		attackers, targets := sides[0], sides[1]
+
+		if pairs := len(attackers) * len(targets); pairs > maxMatchupPairs {
+			err := fmt.Errorf("matchup matrix of %d attackers by %d targets exceeds %d pairs, narrow the attacker. or target. filters",
+				len(attackers), len(targets), maxMatchupPairs)
+			writeErrorJSON(w, http.StatusBadRequest, err.Error())
+			log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+			return
+		}
+
+		// Step 4: Compute the matrix
+		result = &MatchupResult{
+			Version:   version,
+			Attackers: make([]MatchupFighter, len(attackers)),
+			Targets:   make([]MatchupFighter, len(targets)),
+			Matrix:    CalculateMatchups(attackers, targets),
+		}
+		for i := range attackers {
+			result.Attackers[i] = newMatchupFighter(&attackers[i])
+		}
+		for i := range targets {
+			result.Targets[i] = newMatchupFighter(&targets[i])
+		}
+		h.store(version, key, result)
+	}
+
+	log.Printf("returning %dx%d matchups to %s (cached: %v)", len(result.Attackers), len(result.Targets), r.RemoteAddr, cached)
+	if strings.EqualFold(r.Form.Get("format"), "csv") {
+		writeMatchupCSV(w, result, strings.ToLower(r.Form.Get("metric")))
+		return
+	}
+	writeJSON(w, result)
+}
+
+// writeMatchupCSV writes the matrix as CSV with one row per attacker and one column per target
+func writeMatchupCSV(w http.ResponseWriter, result *MatchupResult, metric string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="matchups.csv"`)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	writer := csv.NewWriter(w)
+	header := []string{"attacker_id", "attacker"}
+	for _, t := range result.Targets {
+		header = append(header, t.Name)
+	}
+	rows := [][]string{header}
+
+	for i, a := range result.Attackers {
+		row := []string{a.Id, a.Name}
+		for _, m := range result.Matrix[i] {
+			row = append(row, matchupMetric(m, metric))
+		}
+		rows = append(rows, row)
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		log.Printf("WARNING: failed to write CSV response -- %s", err)
+	}
+}
+
+// matchupMetric formats the requested metric of a matchup for CSV, defaulting to expected damage
+func matchupMetric(m Matchup, metric string) string {
+	switch metric {
+	case "actions_to_kill":
+		if m.ActionsToKill == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*m.ActionsToKill, 'f', 3, 64)
+	case "kill_chance":
+		return strconv.FormatFloat(m.KillChance, 'f', 4, 64)
+	}
+	return strconv.FormatFloat(m.ExpectedDamage, 'f', 3, 64)
+}
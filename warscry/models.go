@@ -1,12 +1,15 @@
 package warscry
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
 )
 
 // Characteristic represents a non-negative game statistic
@@ -39,6 +42,49 @@ func (c *Characteristic) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// AbilityCost is the cost of an ability, read from the "cost" key
+type AbilityCost string
+
+const (
+	CostDouble      AbilityCost = "double"
+	CostTriple      AbilityCost = "triple"
+	CostQuad        AbilityCost = "quad"
+	CostReaction    AbilityCost = "reaction"
+	CostBattleTrait AbilityCost = "battle_trait"
+)
+
+// AbilityCosts lists every known cost, dice costs first in ascending order
+var AbilityCosts = []AbilityCost{CostDouble, CostTriple, CostQuad, CostReaction, CostBattleTrait}
+
+// Valid reports whether c is a known cost
+func (c AbilityCost) Valid() bool {
+	return slices.Contains(AbilityCosts, c)
+}
+
+// Dice returns the number of matching ability dice the cost needs, or 0 for reactions and battle traits
+func (c AbilityCost) Dice() int {
+	switch c {
+	case CostDouble:
+		return 2
+	case CostTriple:
+		return 3
+	case CostQuad:
+		return 4
+	}
+	return 0
+}
+
+// Compare orders costs as listed in AbilityCosts, with unknown costs last
+func (c AbilityCost) Compare(other AbilityCost) int {
+	rank := func(c AbilityCost) int {
+		if i := slices.Index(AbilityCosts, c); i >= 0 {
+			return i
+		}
+		return len(AbilityCosts)
+	}
+	return cmp.Compare(rank(c), rank(other))
+}
+
 // Type aliases for clearer function signatures
 type (
 	FighterID   = string
@@ -50,12 +96,24 @@ type (
 )
 
 type Ability struct {
-	Id              AbilityID   `json:"_id"`
-	Name            AbilityName `json:"name"`
-	Type            string      `json:"cost"`
-	FactionRunemark Runemark    `json:"warband"`
-	Runemarks       []Runemark  `json:"runemarks"`
-	Description     Description `json:"description"`
+	Id              AbilityID      `json:"_id"`
+	Name            AbilityName    `json:"name"`
+	Type            AbilityCost    `json:"cost"`
+	FactionRunemark Runemark       `json:"warband"`
+	Runemarks       []Runemark     `json:"runemarks"`
+	Description     Description    `json:"description"`
+	Universal       bool           `json:"universal"` // available to every warband, set from FactionRunemark when loaded
+	Effects         AbilityEffects `json:"effects"`   // parsed from Description when loaded
+}
+
+func (a *Ability) UnmarshalJSON(data []byte) error {
+	type ability Ability
+	if err := json.Unmarshal(data, (*ability)(a)); err != nil {
+		return err
+	}
+	a.Universal = strings.EqualFold(a.FactionRunemark, UniversalFaction)
+	a.Effects, _ = ParseEffects(a.Description)
+	return nil
 }
 
 type Weapon struct {
@@ -89,17 +147,23 @@ type (
 )
 
 type Warband struct {
-	Name         string    `json:"name"`
-	Fighters     Fighters  `json:"fighters"`
-	Abilities    Abilities `json:"abilities"`
-	BattleTraits Abilities `json:"battle_traits"`
-	// Subfactions  []Subfaction `json:"subfactions"`
+	Name          string       `json:"name"`
+	GrandAlliance string       `json:"grand_alliance,omitempty"`
+	Fighters      Fighters     `json:"fighters"`
+	Abilities     Abilities    `json:"abilities"`
+	BattleTraits  Abilities    `json:"battle_traits"`
+	Subfactions   []Subfaction `json:"subfactions,omitempty"`
 }
 
+// Subfaction is a group of a warband's fighters with their own abilities, such as a bladeborn warband.
+// Its fighters and abilities are also listed on the parent warband.
 type Subfaction struct {
-	Runemark  string `json:"runemark"`
-	Bladeborn bool   `json:"bladeborn"`
-	HeroesAll bool   `json:"heroes_all"`
+	Runemark     string    `json:"runemark"`
+	Bladeborn    bool      `json:"bladeborn"`  // the subfaction has abilities of its own
+	HeroesAll    bool      `json:"heroes_all"` // every fighter in the subfaction is a hero
+	Fighters     Fighters  `json:"fighters,omitempty"`
+	Abilities    Abilities `json:"abilities,omitempty"`
+	BattleTraits Abilities `json:"battle_traits,omitempty"`
 }
 
 func GitLoad(url string) ([]byte, error) {
@@ -154,12 +218,16 @@ func (A *Abilities) FromGit() {
 		log.Fatalf("error unmarshalling ability data -- %s", jsonErr)
 	}
 
-	// Validate all abilities
+	// Validate all abilities, skipping invalid ones so one bad entry (such as a new cost) doesn't stop the server
+	valid := (*A)[:0]
 	for i, ability := range *A {
 		if err := ability.Validate(); err != nil {
-			log.Fatalf("invalid ability data at index %d: %v", i, err)
+			log.Printf("skipping invalid ability data at index %d: %v", i, err)
+			continue
 		}
+		valid = append(valid, ability)
 	}
+	*A = valid
 	log.Printf("loaded and validated %d abilities", len(*A))
 }
 
@@ -218,7 +286,10 @@ func (a *Ability) Validate() error {
 		return errors.New("ability faction runemark cannot be empty")
 	}
 	if a.Type == "" {
-		return errors.New("ability type cannot be empty")
+		return fmt.Errorf("ability '%s' cost cannot be empty", a.Name)
+	}
+	if !a.Type.Valid() {
+		return fmt.Errorf("ability '%s' has unknown cost '%s'", a.Name, a.Type)
 	}
 	return nil
 }
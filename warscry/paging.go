@@ -0,0 +1,256 @@
+package warscry
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SortKey is a single field to order results by
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// Page is the window of results requested via limit/offset or cursor
+type Page struct {
+	Offset int
+	Limit  int // 0 means no limit
+}
+
+// comparator orders two items, returning a negative, zero or positive result like cmp.Compare
+type comparator[T any] func(a, b *T) int
+
+// maxWeaponCharacteristic returns the highest value of a weapon characteristic across a fighter's weapons
+func maxWeaponCharacteristic(f *Fighter, characteristic func(w *Weapon) Characteristic) int {
+	highest := 0
+	for i := range f.Weapons {
+		highest = max(highest, characteristic(&f.Weapons[i]).Int())
+	}
+	return highest
+}
+
+// fighterSortFields maps sortable field names to comparators; weapon characteristics sort by the fighter's best weapon
+var fighterSortFields = map[string]comparator[Fighter]{
+	"_id":            func(a, b *Fighter) int { return cmp.Compare(a.Id, b.Id) },
+	"name":           func(a, b *Fighter) int { return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"warband":        func(a, b *Fighter) int { return cmp.Compare(a.FactionRunemark, b.FactionRunemark) },
+	"subfaction":     func(a, b *Fighter) int { return cmp.Compare(a.Subfaction, b.Subfaction) },
+	"grand_alliance": func(a, b *Fighter) int { return cmp.Compare(a.GrandAlliance, b.GrandAlliance) },
+	"movement":       func(a, b *Fighter) int { return cmp.Compare(a.Movement, b.Movement) },
+	"toughness":      func(a, b *Fighter) int { return cmp.Compare(a.Toughness, b.Toughness) },
+	"wounds":         func(a, b *Fighter) int { return cmp.Compare(a.Wounds, b.Wounds) },
+	"points":         func(a, b *Fighter) int { return cmp.Compare(a.Points, b.Points) },
+	"attacks":        weaponComparator(func(w *Weapon) Characteristic { return w.Attacks }),
+	"strength":       weaponComparator(func(w *Weapon) Characteristic { return w.Strength }),
+	"dmg_hit":        weaponComparator(func(w *Weapon) Characteristic { return w.DamageHit }),
+	"dmg_crit":       weaponComparator(func(w *Weapon) Characteristic { return w.DamageCrit }),
+	"min_range":      weaponComparator(func(w *Weapon) Characteristic { return w.MinimumRange }),
+	"max_range":      weaponComparator(func(w *Weapon) Characteristic { return w.MaximumRange }),
+}
+
+func weaponComparator(characteristic func(w *Weapon) Characteristic) comparator[Fighter] {
+	return func(a, b *Fighter) int {
+		return cmp.Compare(maxWeaponCharacteristic(a, characteristic), maxWeaponCharacteristic(b, characteristic))
+	}
+}
+
+// abilitySortFields maps sortable field names to comparators
+var abilitySortFields = map[string]comparator[Ability]{
+	"_id":     func(a, b *Ability) int { return cmp.Compare(a.Id, b.Id) },
+	"name":    func(a, b *Ability) int { return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"warband": func(a, b *Ability) int { return cmp.Compare(a.FactionRunemark, b.FactionRunemark) },
+	"cost":    func(a, b *Ability) int { return a.Type.Compare(b.Type) },
+}
+
+// parseSort parses sort values such as "points,-wounds" (or repeated sort params) into sort keys
+func parseSort[C any](values []string, fields map[string]C) ([]SortKey, error) {
+	var keys []SortKey
+	for _, v := range values {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			key := SortKey{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+			if _, exists := fields[key.Field]; !exists {
+				return nil, QueryError{Parameter: "sort", Value: field, Reason: "not a sortable field"}
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// weaponProfileSortFields maps sortable field names to comparators
+var weaponProfileSortFields = map[string]comparator[WeaponProfile]{
+	"fighter_id": func(a, b *WeaponProfile) int { return cmp.Compare(a.FighterId, b.FighterId) },
+	"fighter_name": func(a, b *WeaponProfile) int {
+		return cmp.Compare(strings.ToLower(a.FighterName), strings.ToLower(b.FighterName))
+	},
+	"warband":         func(a, b *WeaponProfile) int { return cmp.Compare(a.Warband, b.Warband) },
+	"weapon_runemark": func(a, b *WeaponProfile) int { return cmp.Compare(a.Runemark, b.Runemark) },
+	"attacks":         func(a, b *WeaponProfile) int { return cmp.Compare(a.Attacks, b.Attacks) },
+	"strength":        func(a, b *WeaponProfile) int { return cmp.Compare(a.Strength, b.Strength) },
+	"dmg_hit":         func(a, b *WeaponProfile) int { return cmp.Compare(a.DamageHit, b.DamageHit) },
+	"dmg_crit":        func(a, b *WeaponProfile) int { return cmp.Compare(a.DamageCrit, b.DamageCrit) },
+	"min_range":       func(a, b *WeaponProfile) int { return cmp.Compare(a.MinimumRange, b.MinimumRange) },
+	"max_range":       func(a, b *WeaponProfile) int { return cmp.Compare(a.MaximumRange, b.MaximumRange) },
+}
+
+// sortByKeys stably orders items by the given keys, leaving data order for ties
+func sortByKeys[T any](items []T, keys []SortKey, fields map[string]comparator[T]) {
+	if len(keys) == 0 {
+		return
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		for _, key := range keys {
+			c := fields[key.Field](&a, &b)
+			if key.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+// SortFighters stably orders fighters by the given keys, leaving data order for ties
+func SortFighters(fighters Fighters, keys []SortKey) {
+	sortByKeys(fighters, keys, fighterSortFields)
+}
+
+// SortAbilities stably orders abilities by the given keys, leaving data order for ties
+func SortAbilities(abilities Abilities, keys []SortKey) {
+	sortByKeys(abilities, keys, abilitySortFields)
+}
+
+// SortWeaponProfiles stably orders weapon profiles by the given keys, leaving data order for ties
+func SortWeaponProfiles(profiles []WeaponProfile, keys []SortKey) {
+	sortByKeys(profiles, keys, weaponProfileSortFields)
+}
+
+// pagingParams are the parameters that select a page rather than the results being paged through
+var pagingParams = []string{"cursor", "offset", "limit"}
+
+// queryHash identifies the filters and sort order of a request, so a cursor can only continue the query it came from
+// Paging parameters and empty values are ignored, and parameters are hashed in name order
+func queryHash(form url.Values) string {
+	normalised := url.Values{}
+	for param, values := range form {
+		if slices.Contains(pagingParams, param) {
+			continue
+		}
+		for _, v := range values {
+			if v != "" {
+				normalised.Add(param, v)
+			}
+		}
+	}
+	sum := sha256.Sum256([]byte(normalised.Encode()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// encodeCursor builds an opaque cursor for the page starting at offset, tied to the data hash and the query
+func encodeCursor(dataHash string, form url.Values, offset int, limit int) string {
+	raw := fmt.Sprintf("%s:%s:%d:%d", dataHash, queryHash(form), offset, limit)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor reverses encodeCursor, rejecting cursors issued for different data or a different query
+func decodeCursor(cursor string, dataHash string, form url.Values) (Page, error) {
+	invalid := QueryError{Parameter: "cursor", Value: cursor, Reason: "malformed cursor"}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Page{}, invalid
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 4 {
+		return Page{}, invalid
+	}
+	offset, oErr := strconv.Atoi(parts[2])
+	limit, lErr := strconv.Atoi(parts[3])
+	if oErr != nil || lErr != nil || offset < 0 || limit < 0 {
+		return Page{}, invalid
+	}
+	if parts[0] != dataHash {
+		return Page{}, QueryError{Parameter: "cursor", Value: cursor, Reason: "cursor has expired because the data has been refreshed"}
+	}
+	if parts[1] != queryHash(form) {
+		return Page{}, QueryError{Parameter: "cursor", Value: cursor, Reason: "cursor was issued for different filters or sort order"}
+	}
+	return Page{Offset: offset, Limit: limit}, nil
+}
+
+// parsePage reads limit, offset and cursor parameters; an explicit limit overrides the cursor's
+func parsePage(form url.Values, dataHash string) (Page, error) {
+	var page Page
+
+	if form.Get("cursor") != "" {
+		if form.Get("offset") != "" {
+			return Page{}, QueryError{Parameter: "offset", Value: form.Get("offset"), Reason: "cannot be combined with cursor"}
+		}
+		cursorPage, err := decodeCursor(form.Get("cursor"), dataHash, form)
+		if err != nil {
+			return Page{}, err
+		}
+		page = cursorPage
+	}
+
+	if v := form.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return Page{}, QueryError{Parameter: "offset", Value: v, Reason: "must be a non-negative integer"}
+		}
+		page.Offset = offset
+	}
+
+	if v := form.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return Page{}, QueryError{Parameter: "limit", Value: v, Reason: "must be a positive integer"}
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+// paginate returns the window of items selected by page
+func paginate[S ~[]E, E any](items S, page Page) S {
+	start := min(page.Offset, len(items))
+	end := len(items)
+	if page.Limit > 0 {
+		end = min(start+page.Limit, len(items))
+	}
+	return items[start:end]
+}
+
+// setPageHeaders reports the total match count and, if more results remain, a cursor and link to the next page
+func setPageHeaders(w http.ResponseWriter, r *http.Request, total int, page Page, dataHash string) {
+	w.Header().Add("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, Link")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if page.Limit == 0 || page.Offset+page.Limit >= total {
+		return
+	}
+
+	cursor := encodeCursor(dataHash, r.Form, page.Offset+page.Limit, page.Limit)
+	w.Header().Set("X-Next-Cursor", cursor)
+
+	next := *r.URL
+	query := next.Query()
+	query.Del("offset")
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+}
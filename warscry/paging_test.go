@@ -0,0 +1,142 @@
+package warscry
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	form := url.Values{"warband": {"khorne"}, "sort": {"-points"}, "limit": {"10"}}
+	cursor := encodeCursor("abcd", form, 20, 10)
+
+	page, err := decodeCursor(cursor, "abcd", form)
+	if err != nil {
+		t.Fatalf("decodeCursor(%q) returned error: %v", cursor, err)
+	}
+	if want := (Page{Offset: 20, Limit: 10}); page != want {
+		t.Errorf("decodeCursor(%q) = %+v, want %+v", cursor, page, want)
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	form := url.Values{"warband": {"khorne"}, "sort": {"-points"}}
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name     string
+		cursor   string
+		dataHash string
+		form     url.Values
+		want     string
+	}{
+		{"not base64url", "a+b/c", "abcd", form, "malformed cursor"},
+		{"missing fields", raw("abcd:" + queryHash(form) + ":20"), "abcd", form, "malformed cursor"},
+		{"non-numeric offset", raw("abcd:" + queryHash(form) + ":x:10"), "abcd", form, "malformed cursor"},
+		{"negative offset", raw("abcd:" + queryHash(form) + ":-1:10"), "abcd", form, "malformed cursor"},
+		{"data refreshed", encodeCursor("abcd", form, 20, 10), "ef01", form, "data has been refreshed"},
+		{"different filter", encodeCursor("abcd", form, 20, 10), "abcd", url.Values{"warband": {"stormcast"}, "sort": {"-points"}}, "different filters or sort order"},
+		{"different sort", encodeCursor("abcd", form, 20, 10), "abcd", url.Values{"warband": {"khorne"}, "sort": {"points"}}, "different filters or sort order"},
+		{"filter added", encodeCursor("abcd", form, 20, 10), "abcd", url.Values{"warband": {"khorne"}, "sort": {"-points"}, "hero": {"true"}}, "different filters or sort order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor, tt.dataHash, tt.form)
+			var queryErr QueryError
+			if !errors.As(err, &queryErr) || queryErr.Parameter != "cursor" {
+				t.Fatalf("decodeCursor(%q) returned %v, want a cursor QueryError", tt.cursor, err)
+			}
+			if !strings.Contains(queryErr.Reason, tt.want) {
+				t.Errorf("decodeCursor(%q) reason = %q, want it to contain %q", tt.cursor, queryErr.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryHashIgnoresPagingAndEmptyValues(t *testing.T) {
+	base := url.Values{"warband": {"khorne"}, "sort": {"-points"}}
+	same := url.Values{"sort": {"-points"}, "warband": {"khorne"}, "limit": {"5"}, "offset": {"10"}, "cursor": {"abc"}, "hero": {""}}
+	if queryHash(base) != queryHash(same) {
+		t.Errorf("queryHash(%v) != queryHash(%v)", base, same)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	form := url.Values{"warband": {"khorne"}}
+	cursor := encodeCursor("abcd", form, 20, 10)
+	withCursor := func(extra ...string) url.Values {
+		f := url.Values{"warband": {"khorne"}, "cursor": {cursor}}
+		for i := 0; i < len(extra); i += 2 {
+			f.Set(extra[i], extra[i+1])
+		}
+		return f
+	}
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		want    Page
+		wantErr string
+	}{
+		{"no paging", form, Page{}, ""},
+		{"limit and offset", url.Values{"limit": {"5"}, "offset": {"15"}}, Page{Offset: 15, Limit: 5}, ""},
+		{"cursor", withCursor(), Page{Offset: 20, Limit: 10}, ""},
+		{"limit overrides the cursor's", withCursor("limit", "3"), Page{Offset: 20, Limit: 3}, ""},
+		{"cursor with offset", withCursor("offset", "5"), Page{}, "offset"},
+		{"zero limit", url.Values{"limit": {"0"}}, Page{}, "limit"},
+		{"negative offset", url.Values{"offset": {"-1"}}, Page{}, "offset"},
+		{"non-numeric limit", url.Values{"limit": {"ten"}}, Page{}, "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := parsePage(tt.form, "abcd")
+			if tt.wantErr != "" {
+				var queryErr QueryError
+				if !errors.As(err, &queryErr) || queryErr.Parameter != tt.wantErr {
+					t.Errorf("parsePage(%v) returned %v, want a %s QueryError", tt.form, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePage(%v) returned error: %v", tt.form, err)
+			}
+			if page != tt.want {
+				t.Errorf("parsePage(%v) = %+v, want %+v", tt.form, page, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePageRejectsCursorAfterRefresh(t *testing.T) {
+	form := url.Values{"warband": {"khorne"}, "limit": {"2"}}
+	form.Set("cursor", encodeCursor("abcd", form, 2, 2))
+
+	if _, err := parsePage(form, "abcd"); err != nil {
+		t.Fatalf("parsePage returned error for the data the cursor was issued for: %v", err)
+	}
+	if _, err := parsePage(form, "ef01"); err == nil {
+		t.Error("parsePage accepted a cursor issued before the data changed")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		page Page
+		want int
+	}{
+		{Page{}, 5},
+		{Page{Limit: 2}, 2},
+		{Page{Offset: 4, Limit: 2}, 1},
+		{Page{Offset: 10, Limit: 2}, 0},
+	}
+	for _, tt := range tests {
+		if got := paginate(items, tt.page); len(got) != tt.want {
+			t.Errorf("paginate(%+v) returned %v, want %d items", tt.page, got, tt.want)
+		}
+	}
+}
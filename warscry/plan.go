@@ -0,0 +1,562 @@
+package warscry
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// parallelMatchThreshold is the number of candidates below which a plan is evaluated in a single pass;
+// for smaller sets, coordinating workers costs more than matching
+const parallelMatchThreshold = 2048
+
+// intOperators resolves integer operator suffixes once, rather than per fighter
+var intOperators = map[string]Operator{
+	"":      Equals,
+	"__gt":  GreaterThan,
+	"__gte": GreaterThanOrEqualTo,
+	"__lt":  LessThan,
+	"__lte": LessThanOrEqualTo,
+}
+
+// intFilter is an integer param and its operator variants, parsed once per request
+// A value matches if it satisfies every check
+type intFilter []func(int) bool
+
+func (f intFilter) matches(v int) bool {
+	for _, check := range f {
+		if !check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileIntFilter parses param and its operator variants: every variant must be satisfied, by any of its values
+func compileIntFilter(form url.Values, param string) (intFilter, error) {
+	var filter intFilter
+
+	for _, suffix := range []string{"", "__gt", "__gte", "__lt", "__lte", "__ne"} {
+		values, requested := form[param+suffix]
+		if !requested {
+			continue
+		}
+		ints, err := parseIntValues(param+suffix, values)
+		if err != nil {
+			return nil, err
+		}
+		if len(ints) == 0 {
+			continue
+		}
+		if suffix == "__ne" {
+			// __ne excludes every listed value, rather than including any that differ
+			filter = append(filter, func(v int) bool { return !slices.Contains(ints, v) })
+			continue
+		}
+		op := intOperators[suffix]
+		filter = append(filter, func(v int) bool {
+			return slices.ContainsFunc(ints, func(requested int) bool { return op(v, requested) })
+		})
+	}
+
+	// __in matches any value of any list, so the lists are merged
+	if values := form[param+"__in"]; len(values) > 0 {
+		var in []int
+		for _, value := range values {
+			ints, err := parseIntList(value)
+			if err != nil {
+				return nil, QueryError{Parameter: param + "__in", Value: value, Reason: "must be a comma-separated list of integers"}
+			}
+			in = append(in, ints...)
+		}
+		filter = append(filter, func(v int) bool { return slices.Contains(in, v) })
+	}
+
+	if values := form[param+"__between"]; len(values) > 0 {
+		var ranges [][]int
+		for _, value := range values {
+			bounds, err := parseIntList(value)
+			if err != nil || len(bounds) != 2 {
+				return nil, QueryError{Parameter: param + "__between", Value: value, Reason: "must be two comma-separated integers, min,max"}
+			}
+			ranges = append(ranges, bounds)
+		}
+		filter = append(filter, func(v int) bool {
+			return slices.ContainsFunc(ranges, func(bounds []int) bool { return v >= bounds[0] && v <= bounds[1] })
+		})
+	}
+
+	return filter, nil
+}
+
+// parseIntValues parses every value of an integer param
+func parseIntValues(param string, values []string) ([]int, error) {
+	ints := make([]int, 0, len(values))
+	for _, value := range values {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, QueryError{Parameter: param, Value: value, Reason: "must be an integer"}
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// stringFilter is a string param and its operator variants with values lower-cased and regexes compiled once
+// A characteristic matches if it satisfies every check; checks are given the lower-cased characteristic
+type stringFilter []func(string) bool
+
+func (f stringFilter) matches(characteristic string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	characteristic = strings.ToLower(characteristic)
+	for _, check := range f {
+		if !check(characteristic) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileStringFilter compiles param and its operator variants: every variant must be satisfied, by any of its
+// values, and __not/__ne exclude every value
+func compileStringFilter(form url.Values, param string) (stringFilter, error) {
+	var filter stringFilter
+
+	for _, variant := range []struct {
+		suffix    string
+		predicate stringPredicate
+		exclude   bool
+	}{
+		{"", equalsString, false},
+		{"__contains", containsString, false},
+		{"__startswith", hasPrefixString, false},
+		{"__not", equalsString, true},
+		{"__ne", equalsString, true},
+	} {
+		values := lowerValues(form[param+variant.suffix])
+		if len(values) == 0 {
+			continue
+		}
+		predicate, exclude := variant.predicate, variant.exclude
+		filter = append(filter, func(characteristic string) bool {
+			matched := slices.ContainsFunc(values, func(v string) bool { return predicate(characteristic, v) })
+			return matched != exclude
+		})
+	}
+
+	regexes, err := compileRegexValues(form, param+"__regex")
+	if err != nil {
+		return nil, err
+	}
+	if len(regexes) > 0 {
+		filter = append(filter, func(characteristic string) bool {
+			return slices.ContainsFunc(regexes, func(re *regexp.Regexp) bool { return re.MatchString(characteristic) })
+		})
+	}
+
+	return filter, nil
+}
+
+// sliceFilter is a list param such as runemarks and its operator variants, compiled once per request
+type sliceFilter []func([]string) bool
+
+func (f sliceFilter) matches(characteristic []string) bool {
+	for _, check := range f {
+		if !check(characteristic) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileSliceFilter compiles param and its operator variants: every requested value must be matched by some
+// element, and __not/__ne exclude any element equal to any value
+func compileSliceFilter(form url.Values, param string) (sliceFilter, error) {
+	var filter sliceFilter
+
+	if values := lowerValues(form[param]); len(values) > 0 {
+		filter = append(filter, func(characteristic []string) bool {
+			for _, v := range values {
+				if !slices.Contains(characteristic, v) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	// every requested value must be matched by some element
+	for _, variant := range []struct {
+		suffix    string
+		predicate stringPredicate
+	}{
+		{"__contains", containsString},
+		{"__startswith", hasPrefixString},
+	} {
+		values := lowerValues(form[param+variant.suffix])
+		if len(values) == 0 {
+			continue
+		}
+		predicate := variant.predicate
+		filter = append(filter, func(characteristic []string) bool {
+			for _, v := range values {
+				if !slices.ContainsFunc(characteristic, func(c string) bool { return predicate(strings.ToLower(c), v) }) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	regexes, err := compileRegexValues(form, param+"__regex")
+	if err != nil {
+		return nil, err
+	}
+	if len(regexes) > 0 {
+		filter = append(filter, func(characteristic []string) bool {
+			for _, re := range regexes {
+				if !slices.ContainsFunc(characteristic, func(c string) bool { return re.MatchString(strings.ToLower(c)) }) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	// __not and __ne exclude any element equal to any value
+	if excluded := lowerValues(append(slices.Clone(form[param+"__not"]), form[param+"__ne"]...)); len(excluded) > 0 {
+		filter = append(filter, func(characteristic []string) bool {
+			return !slices.ContainsFunc(characteristic, func(c string) bool { return slices.Contains(excluded, strings.ToLower(c)) })
+		})
+	}
+
+	return filter, nil
+}
+
+// lowerValues returns the values lower-cased, for case-insensitive comparison
+func lowerValues(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
+
+// compileRegexValues compiles every value of a __regex param
+func compileRegexValues(form url.Values, param string) ([]*regexp.Regexp, error) {
+	var regexes []*regexp.Regexp
+	for _, value := range form[param] {
+		re, err := compileRegex(value)
+		if err != nil {
+			return nil, QueryError{Parameter: param, Value: value, Reason: fmt.Sprintf("must be a valid regular expression: %v", err)}
+		}
+		regexes = append(regexes, re)
+	}
+	return regexes, nil
+}
+
+// fighterIntParams and weaponIntParams read the integer characteristics filtered on /fighters
+var (
+	fighterIntParams = []struct {
+		param          string
+		characteristic func(f *Fighter) Characteristic
+	}{
+		{"movement", func(f *Fighter) Characteristic { return f.Movement }},
+		{"wounds", func(f *Fighter) Characteristic { return f.Wounds }},
+		{"points", func(f *Fighter) Characteristic { return f.Points }},
+		{"toughness", func(f *Fighter) Characteristic { return f.Toughness }},
+	}
+	weaponIntParams = []struct {
+		param          string
+		characteristic func(w *Weapon) Characteristic
+	}{
+		{"attacks", func(w *Weapon) Characteristic { return w.Attacks }},
+		{"strength", func(w *Weapon) Characteristic { return w.Strength }},
+		{"dmg_hit", func(w *Weapon) Characteristic { return w.DamageHit }},
+		{"dmg_crit", func(w *Weapon) Characteristic { return w.DamageCrit }},
+		{"max_range", func(w *Weapon) Characteristic { return w.MaximumRange }},
+		{"min_range", func(w *Weapon) Characteristic { return w.MinimumRange }},
+	}
+)
+
+// fighterCheck and weaponCheck are single compiled conditions on a fighter or a weapon
+type (
+	fighterCheck func(f *Fighter) bool
+	weaponCheck  func(w *Weapon) bool
+)
+
+// FighterPlan is a /fighters request compiled once into typed checks, so matching a fighter does no
+// parsing, operator lookup or allocation. Only requested params become checks
+type FighterPlan struct {
+	checks          []fighterCheck
+	weaponChecks    []weaponCheck
+	matchAllWeapons bool
+	query           *Query[Fighter]
+
+	// exact-match values used to prune candidates with the snapshot's indexes
+	ids       []string
+	warbands  []string
+	runemarks []string
+}
+
+// CompileFighterPlan compiles /fighters filters, including the q= expression, into a plan
+// The form should already be validated; any value that still fails to parse is returned as a QueryError
+func CompileFighterPlan(form url.Values) (*FighterPlan, error) {
+	plan := &FighterPlan{
+		matchAllWeapons: strings.EqualFold(form.Get("weapon_match"), "all"),
+		ids:             lowerValues(form["_id"]),
+		warbands:        lowerValues(form["warband"]),
+		runemarks:       lowerValues(form["runemarks"]),
+	}
+
+	// fighter string characteristics
+	for _, field := range []struct {
+		param          string
+		characteristic func(f *Fighter) string
+	}{
+		{"name", func(f *Fighter) string { return f.Name }},
+		{"_id", func(f *Fighter) string { return f.Id }},
+		{"subfaction", func(f *Fighter) string { return f.Subfaction }},
+		{"grand_alliance", func(f *Fighter) string { return f.GrandAlliance }},
+		{"warband", func(f *Fighter) string { return f.FactionRunemark }},
+	} {
+		filter, err := compileStringFilter(form, field.param)
+		if err != nil {
+			return nil, err
+		}
+		if len(filter) > 0 {
+			characteristic := field.characteristic
+			plan.checks = append(plan.checks, func(f *Fighter) bool { return filter.matches(characteristic(f)) })
+		}
+	}
+	if values := form["name__fuzzy"]; len(values) > 0 {
+		plan.checks = append(plan.checks, func(f *Fighter) bool { return bestNameSimilarity(values, f.Name) >= minFuzzySimilarity })
+	}
+
+	// fighter []string characteristics
+	runemarks, err := compileSliceFilter(form, "runemarks")
+	if err != nil {
+		return nil, err
+	}
+	if len(runemarks) > 0 {
+		plan.checks = append(plan.checks, func(f *Fighter) bool { return runemarks.matches(f.Runemarks) })
+	}
+
+	// fighter int characteristics
+	for _, field := range fighterIntParams {
+		filter, err := compileIntFilter(form, field.param)
+		if err != nil {
+			return nil, err
+		}
+		if len(filter) > 0 {
+			characteristic := field.characteristic
+			plan.checks = append(plan.checks, func(f *Fighter) bool { return filter.matches(characteristic(f).Int()) })
+		}
+	}
+
+	// weapon characteristics
+	weaponRunemark, err := compileStringFilter(form, "weapon_runemark")
+	if err != nil {
+		return nil, err
+	}
+	if len(weaponRunemark) > 0 {
+		plan.weaponChecks = append(plan.weaponChecks, func(w *Weapon) bool { return weaponRunemark.matches(w.Runemark) })
+	}
+	for _, field := range weaponIntParams {
+		filter, err := compileIntFilter(form, field.param)
+		if err != nil {
+			return nil, err
+		}
+		if len(filter) > 0 {
+			characteristic := field.characteristic
+			plan.weaponChecks = append(plan.weaponChecks, func(w *Weapon) bool { return filter.matches(characteristic(w).Int()) })
+		}
+	}
+
+	query, err := ParseFighterQuery(form["q"])
+	if err != nil {
+		return nil, err
+	}
+	plan.query = query
+
+	return plan, nil
+}
+
+// matchesWeapon reports whether a weapon satisfies every weapon check
+func (p *FighterPlan) matchesWeapon(w *Weapon) bool {
+	for _, check := range p.weaponChecks {
+		if !check(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether a fighter satisfies the plan. Fighters without weapons pass the weapon checks;
+// otherwise any weapon (or with weapon_match=all, every weapon) must match
+func (p *FighterPlan) Matches(f *Fighter) bool {
+	for _, check := range p.checks {
+		if !check(f) {
+			return false
+		}
+	}
+
+	if len(p.weaponChecks) > 0 && len(f.Weapons) > 0 {
+		matches := func(w Weapon) bool { return p.matchesWeapon(&w) }
+		if p.matchAllWeapons {
+			if slices.ContainsFunc(f.Weapons, func(w Weapon) bool { return !matches(w) }) {
+				return false
+			}
+		} else if !slices.ContainsFunc(f.Weapons, matches) {
+			return false
+		}
+	}
+
+	return p.query.Matches(f)
+}
+
+// MatchingWeapons returns the fighter's weapons that satisfy the plan's weapon checks
+func (p *FighterPlan) MatchingWeapons(f *Fighter) []Weapon {
+	var weapons []Weapon
+	for i := range f.Weapons {
+		if p.matchesWeapon(&f.Weapons[i]) {
+			weapons = append(weapons, f.Weapons[i])
+		}
+	}
+	return weapons
+}
+
+// candidates returns the positions of fighters that can match the plan's exact _id, warband and runemarks
+// values, in data order. pruned is false when the plan has no such values and every fighter is a candidate
+func (p *FighterPlan) candidates(lookup *fighterLookup) (positions []int, pruned bool) {
+	narrow := func(set []int) {
+		if !pruned {
+			positions, pruned = set, true
+			return
+		}
+		positions = intersectSorted(positions, set)
+	}
+
+	// any of several _id or warband values may match
+	if len(p.ids) > 0 {
+		narrow(unionPositions(lookup.byId, p.ids))
+	}
+	if len(p.warbands) > 0 {
+		narrow(unionPositions(lookup.byWarband, p.warbands))
+	}
+	// every runemark must be carried
+	for _, runemark := range p.runemarks {
+		narrow(lookup.byRunemark[runemark])
+	}
+	return positions, pruned
+}
+
+// Select returns the snapshot's fighters matching the plan, in data order
+// Candidates are pruned with the snapshot's indexes, then matched in a single pass, or by a bounded pool
+// of workers over contiguous chunks when there are many
+func (p *FighterPlan) Select(snap *Snapshot) Fighters {
+	fighters := snap.GetFighters()
+	positions, pruned := p.candidates(snap.fighterLookup)
+	count := len(fighters)
+	if pruned {
+		count = len(positions)
+	}
+	position := func(i int) int {
+		if pruned {
+			return positions[i]
+		}
+		return i
+	}
+
+	matches := make([]bool, count)
+	matchRange := func(start, end int) {
+		for i := start; i < end; i++ {
+			matches[i] = p.Matches(&fighters[position(i)])
+		}
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), count/parallelMatchThreshold)
+	if workers <= 1 {
+		matchRange(0, count)
+	} else {
+		var wg sync.WaitGroup
+		chunk := (count + workers - 1) / workers
+		for start := 0; start < count; start += chunk {
+			wg.Add(1)
+			go func(start, end int) {
+				defer wg.Done()
+				matchRange(start, end)
+			}(start, min(start+chunk, count))
+		}
+		wg.Wait()
+	}
+
+	var selected Fighters
+	for i, matched := range matches {
+		if matched {
+			selected = append(selected, fighters[position(i)])
+		}
+	}
+	return selected
+}
+
+// fighterLookup indexes fighter positions by exact-match characteristics, built once per snapshot
+// Positions are in data order so pruned candidates keep the order of an unpruned scan
+type fighterLookup struct {
+	byId       map[string][]int // lower-cased _id
+	byWarband  map[string][]int // lower-cased warband
+	byRunemark map[string][]int // runemark as stored, matched against lower-cased values like StringSliceInclude
+}
+
+func newFighterLookup(fighters Fighters) *fighterLookup {
+	lookup := &fighterLookup{
+		byId:       make(map[string][]int, len(fighters)),
+		byWarband:  make(map[string][]int),
+		byRunemark: make(map[string][]int),
+	}
+	for i := range fighters {
+		f := &fighters[i]
+		lookup.byId[strings.ToLower(f.Id)] = append(lookup.byId[strings.ToLower(f.Id)], i)
+		lookup.byWarband[strings.ToLower(f.FactionRunemark)] = append(lookup.byWarband[strings.ToLower(f.FactionRunemark)], i)
+		runemarks := slices.Clone(f.Runemarks)
+		slices.Sort(runemarks)
+		for _, runemark := range slices.Compact(runemarks) {
+			lookup.byRunemark[runemark] = append(lookup.byRunemark[runemark], i)
+		}
+	}
+	return lookup
+}
+
+// unionPositions merges the positions indexed under any of the keys, in data order
+func unionPositions(index map[string][]int, keys []string) []int {
+	var positions []int
+	for _, key := range keys {
+		positions = append(positions, index[key]...)
+	}
+	slices.Sort(positions)
+	return slices.Compact(positions)
+}
+
+// intersectSorted returns the positions present in both sorted slices
+func intersectSorted(a, b []int) []int {
+	var both []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+	return both
+}
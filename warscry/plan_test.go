@@ -0,0 +1,293 @@
+package warscry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// generatedFighters builds n fighters spread over five warbands with varied characteristics, runemarks and
+// weapons, in place of the published data, which isn't available to tests
+func generatedFighters(n int) Fighters {
+	warbands := []struct{ name, alliance string }{
+		{"stormcast-eternals", "order"},
+		{"khorne", "chaos"},
+		{"nighthaunt", "death"},
+		{"gloomspite-gitz", "destruction"},
+		{"chaos-beasts", "chaos"},
+	}
+	names := []string{"Lord-Celestant", "Liberator", "Bloodreaver", "Chainrasp", "Stabba", "Chaos Troll", "Prosecutor"}
+	runemarks := []string{"hero", "leader", "warrior", "fly", "beast", "berserker", "brute", "mystic", "ally", "thrall"}
+	weaponRunemarks := []string{"sword", "axe", "hammer", "claws", "ranged-weapon", "club"}
+
+	fighters := make(Fighters, n)
+	for i := range fighters {
+		warband := warbands[i%len(warbands)]
+		marks := []string{runemarks[i%len(runemarks)]}
+		if second := runemarks[(i/len(runemarks))%len(runemarks)]; second != marks[0] {
+			marks = append(marks, second)
+		}
+		subfaction := ""
+		if i%9 == 0 {
+			subfaction = "magores-fiends"
+		}
+		weapons := []Weapon{{
+			Runemark:     weaponRunemarks[i%len(weaponRunemarks)],
+			MaximumRange: 1,
+			Attacks:      Characteristic(2 + i%4),
+			Strength:     Characteristic(3 + i%3),
+			DamageHit:    Characteristic(1 + i%3),
+			DamageCrit:   Characteristic(3 + i%4),
+		}}
+		if i%4 == 0 {
+			weapons = append(weapons, Weapon{Runemark: "ranged-weapon", MinimumRange: 3, MaximumRange: 12, Attacks: 2, Strength: 3, DamageHit: 2, DamageCrit: 4})
+		}
+		fighters[i] = Fighter{
+			Id:              fmt.Sprintf("f%04d", i),
+			Name:            fmt.Sprintf("%s %d", names[i%len(names)], i),
+			FactionRunemark: warband.name,
+			Runemarks:       marks,
+			Subfaction:      subfaction,
+			GrandAlliance:   warband.alliance,
+			Movement:        Characteristic(3 + i%6),
+			Toughness:       Characteristic(3 + i%4),
+			Wounds:          Characteristic(8 + i%25),
+			Points:          Characteristic(50 + (i*37)%200),
+			Weapons:         weapons,
+		}
+	}
+	return fighters
+}
+
+// includeFighter matches a fighter the way /fighters did before FighterPlan: with the per-characteristic include
+// functions, Weapon.MatchesRequest for every weapon, and the q= expression evaluated on its own
+func includeFighter(f *Fighter, form url.Values, query *Query[Fighter]) (bool, error) {
+	for _, field := range []struct {
+		param          string
+		characteristic string
+	}{
+		{"name", f.Name},
+		{"_id", f.Id},
+		{"subfaction", f.Subfaction},
+		{"grand_alliance", f.GrandAlliance},
+		{"warband", f.FactionRunemark},
+	} {
+		if !StringParamInclude(field.characteristic, form, field.param) {
+			return false, nil
+		}
+	}
+	if !FuzzyParamInclude(f.Name, form, "name") || !StringSliceParamInclude(f.Runemarks, form, "runemarks") {
+		return false, nil
+	}
+	for _, field := range fighterIntParams {
+		include, err := IntParamInclude(field.characteristic(f).Int(), form, field.param)
+		if err != nil || !include {
+			return false, err
+		}
+	}
+
+	// any weapon, or with weapon_match=all every weapon, must match
+	r := &http.Request{Form: form}
+	var weaponMatches []bool
+	for i := range f.Weapons {
+		include, err := f.Weapons[i].MatchesRequest(r)
+		if err != nil {
+			return false, err
+		}
+		weaponMatches = append(weaponMatches, include)
+	}
+	if len(weaponMatches) > 0 {
+		if strings.EqualFold(form.Get("weapon_match"), "all") && !All(weaponMatches) {
+			return false, nil
+		}
+		if !Any(weaponMatches) {
+			return false, nil
+		}
+	}
+	return query.Matches(f), nil
+}
+
+func TestFighterPlanSelectMatchesIncludeFunctions(t *testing.T) {
+	queries := []string{
+		"",
+		// pruned by the _id index
+		"_id=f0003",
+		"_id=F0003&_id=f0010",
+		"_id=missing",
+		"_id__ne=f0001",
+		"_id__not=f0001&_id__not=f0002",
+		// pruned by the warband index
+		"warband=khorne",
+		"warband=KHORNE&warband=nighthaunt",
+		"warband__ne=khorne",
+		"warband__not=khorne&warband__not=nighthaunt",
+		"warband__startswith=chaos",
+		// pruned by the runemarks index
+		"runemarks=hero",
+		"runemarks=Hero&runemarks=leader",
+		"runemarks=hero&runemarks=missing",
+		"runemarks__ne=leader&runemarks=hero",
+		"runemarks__not=hero&runemarks__not=fly",
+		"runemarks__contains=er",
+		"runemarks__startswith=b",
+		"runemarks__regex=^fl",
+		// several indexes intersected
+		"_id=f0006&warband=khorne",
+		"_id=f0005&warband=khorne",
+		"warband=khorne&runemarks=beast",
+		"warband=khorne&runemarks=hero&runemarks=leader",
+		// string operators without an index
+		"name=liberator 1",
+		"name__contains=lord",
+		"name__startswith=CHAIN",
+		`name__regex=^\D%2B 1\d$`,
+		"name__not=liberator 1&name__startswith=liberator",
+		"name__ne=stabba 4",
+		"grand_alliance=chaos",
+		"subfaction=magores-fiends&subfaction__ne=",
+		// integer operators
+		"points=124",
+		"points__gt=150",
+		"points__gte=150&points__lte=200",
+		"wounds__lt=10",
+		"movement__ne=4",
+		"movement__ne=4&movement__ne=5",
+		"toughness__in=3,5",
+		"wounds__between=10,15&wounds__between=28,32",
+		"points__in=50&points__in=87,124",
+		// combined
+		"warband=khorne&points__gte=100&runemarks__not=leader",
+		"grand_alliance=chaos&warband__ne=khorne&toughness__gt=4",
+		// weapon filters, matched by any weapon unless weapon_match=all
+		"attacks__gte=4",
+		"attacks__gte=4&strength=5",
+		"weapon_runemark=ranged-weapon",
+		"weapon_runemark__startswith=c&dmg_hit__gt=1",
+		"max_range__gt=1&weapon_match=any",
+		"max_range=1&weapon_match=all",
+		"weapon_runemark__ne=ranged-weapon&weapon_match=all",
+		"dmg_crit__between=5,6&min_range=0&weapon_match=all",
+		"warband=khorne&attacks__in=2,5",
+		// query expressions, alone and with filters
+		"q=runemarks:hero AND points>100",
+		"q=warband:khorne OR wounds<10",
+		"q=NOT runemarks:hero&warband=khorne",
+		"q=attacks>=4 AND strength>=5",
+		"q=(weapon_runemark:ranged-weapon OR runemarks:fly) AND movement>5&points__lt=150",
+		"q=warband:nighthaunt&q=toughness<=4",
+		// fuzzy names
+		"name__fuzzy=lord celestnt",
+		"name__fuzzy=liberatr 1&warband=stormcast-eternals",
+		"name__fuzzy=stabba&name__fuzzy=chainrsp&wounds__gte=20",
+	}
+
+	// the larger set is split between workers
+	for _, n := range []int{200, 3 * parallelMatchThreshold} {
+		snap := NewSnapshot(generatedFighters(n), Abilities{}, Warbands{}, 1, "test")
+		fighters := snap.GetFighters()
+
+		for _, query := range queries {
+			t.Run(fmt.Sprintf("%d/%s", n, query), func(t *testing.T) {
+				form, err := url.ParseQuery(query)
+				if err != nil {
+					t.Fatalf("ParseQuery: %v", err)
+				}
+				plan, err := CompileFighterPlan(form)
+				if err != nil {
+					t.Fatalf("CompileFighterPlan: %v", err)
+				}
+
+				query, err := ParseFighterQuery(form["q"])
+				if err != nil {
+					t.Fatalf("ParseFighterQuery: %v", err)
+				}
+
+				var want []string
+				for i := range fighters {
+					include, err := includeFighter(&fighters[i], form, query)
+					if err != nil {
+						t.Fatalf("includeFighter(%s): %v", fighters[i].Id, err)
+					}
+					if include {
+						want = append(want, fighters[i].Id)
+					}
+				}
+				selected := plan.Select(snap)
+				got := selected.GetIds()
+
+				if len(got) != len(want) {
+					t.Fatalf("Select returned %d fighters, include functions %d", len(got), len(want))
+				}
+				for i := range got {
+					if got[i] != want[i] {
+						t.Fatalf("fighter %d: Select returned %s, include functions %s", i, got[i], want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkFighterPlanSelect(b *testing.B) {
+	// roughly the size of the published fighter data
+	snap := NewSnapshot(generatedFighters(1000), Abilities{}, Warbands{}, 1, "benchmark")
+	fighters := snap.GetFighters()
+
+	for _, bm := range []struct {
+		name  string
+		query string
+	}{
+		{"warband", "warband=khorne"},
+		{"runemarks", "runemarks=hero&runemarks=leader"},
+		{"points", "points__gte=100&points__lte=150"},
+		{"name", "name__contains=lord&wounds__gt=20"},
+		{"weapons", "attacks__gte=4&strength__gte=4"},
+	} {
+		r := httptest.NewRequest("GET", "/fighters?"+bm.query, nil)
+		if err := r.ParseForm(); err != nil {
+			b.Fatalf("ParseForm: %v", err)
+		}
+		query, err := ParseFighterQuery(r.Form["q"])
+		if err != nil {
+			b.Fatalf("ParseFighterQuery: %v", err)
+		}
+
+		b.Run(bm.name+"/plan", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				plan, err := CompileFighterPlan(r.Form)
+				if err != nil {
+					b.Fatalf("CompileFighterPlan: %v", err)
+				}
+				plan.Select(snap)
+			}
+		})
+		// the handler path FighterPlan replaced: a goroutine per fighter, each running the include functions
+		b.Run(bm.name+"/goroutine-per-fighter", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				matches := make([]bool, len(fighters))
+				for j := range fighters {
+					wg.Add(1)
+					go func(j int) {
+						defer wg.Done()
+						matches[j], _ = includeFighter(&fighters[j], r.Form, query)
+					}(j)
+				}
+				wg.Wait()
+
+				var selected Fighters
+				for j, matched := range matches {
+					if matched {
+						selected = append(selected, fighters[j])
+					}
+				}
+			}
+		})
+	}
+}
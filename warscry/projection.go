@@ -0,0 +1,184 @@
+package warscry
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// fighterFieldPaths lists the field paths that can be selected with fields= on fighter responses
+var fighterFieldPaths = []string{
+	"_id", "name", "warband", "runemarks", "subfaction", "grand_alliance",
+	"movement", "toughness", "wounds", "points", "weapons",
+	"weapons.runemark", "weapons.min_range", "weapons.max_range", "weapons.attacks",
+	"weapons.strength", "weapons.dmg_hit", "weapons.dmg_crit",
+	// only present when expanded
+	"abilities", "battle_traits",
+}
+
+// abilityFieldPaths lists the field paths that can be selected with fields= on ability responses
+var abilityFieldPaths = []string{
+	"_id", "name", "cost", "warband", "runemarks", "description", "universal", "effects",
+	"effects.keywords", "effects.ranges", "effects.damage", "effects.targets", "effects.uses_value",
+}
+
+// validFighterExpansions lists the related collections that can be inlined with expand= on fighter responses
+var validFighterExpansions = []string{"abilities", "battle_traits"}
+
+// parseFields splits comma-separated fields values (or repeated fields params) and checks each path is known
+func parseFields(values []string, known []string) ([]string, error) {
+	var fields []string
+	for _, v := range values {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !slices.Contains(known, field) {
+				return nil, QueryError{Parameter: "fields", Value: field, Reason: "not a selectable field"}
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// parseExpand splits comma-separated expand values (or repeated expand params) and checks each is known
+func parseExpand(values []string, known []string) ([]string, error) {
+	var expand []string
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.TrimSpace(strings.ToLower(e))
+			if e == "" {
+				continue
+			}
+			if !slices.Contains(known, e) {
+				return nil, QueryError{
+					Parameter: "expand",
+					Value:     e,
+					Reason:    fmt.Sprintf("must be one of: %s", strings.Join(known, ", ")),
+				}
+			}
+			expand = append(expand, e)
+		}
+	}
+	return expand, nil
+}
+
+// toObject converts a value to its generic JSON object form so fields can be added or removed
+func toObject(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// project keeps only the selected field paths of obj; nested paths such as "weapons.attacks" apply to every array element
+func project(obj map[string]any, fields []string) map[string]any {
+	nested := make(map[string][]string)
+	projected := make(map[string]any, len(fields))
+
+	for _, field := range fields {
+		head, rest, isNested := strings.Cut(field, ".")
+		if !isNested {
+			if v, exists := obj[head]; exists {
+				projected[head] = v
+			}
+			// a whole-field selection wins over any nested selection of the same field
+			nested[head] = nil
+			continue
+		}
+		if sub, seen := nested[head]; !seen || sub != nil {
+			nested[head] = append(sub, rest)
+		}
+	}
+
+	for head, sub := range nested {
+		if sub == nil {
+			continue
+		}
+		switch v := obj[head].(type) {
+		case map[string]any:
+			projected[head] = project(v, sub)
+		case []any:
+			items := make([]any, 0, len(v))
+			for _, item := range v {
+				if m, isObj := item.(map[string]any); isObj {
+					items = append(items, project(m, sub))
+				} else {
+					items = append(items, item)
+				}
+			}
+			projected[head] = items
+		}
+	}
+	return projected
+}
+
+// shapeFighters applies expand= and fields= to fighters, returning the fighters unchanged if neither was requested
+func shapeFighters(fighters Fighters, fields []string, expand []string, warbands Warbands) (any, error) {
+	if len(fields) == 0 && len(expand) == 0 {
+		return fighters, nil
+	}
+
+	shaped := make([]map[string]any, 0, len(fighters))
+	for i := range fighters {
+		obj, err := shapeFighter(&fighters[i], fields, expand, warbands)
+		if err != nil {
+			return nil, err
+		}
+		shaped = append(shaped, obj)
+	}
+	return shaped, nil
+}
+
+// shapeFighter converts a single fighter to its expanded and projected object form
+func shapeFighter(f *Fighter, fields []string, expand []string, warbands Warbands) (map[string]any, error) {
+	obj, err := toObject(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(expand) > 0 {
+		warband := warbands.GetWarband(f.FactionRunemark)
+		if warband == nil {
+			warband = &Warband{}
+		}
+		for _, e := range expand {
+			switch e {
+			case "abilities":
+				obj["abilities"] = warband.Abilities.UsableBy(f)
+			case "battle_traits":
+				obj["battle_traits"] = warband.BattleTraits.UsableBy(f)
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		obj = project(obj, fields)
+	}
+	return obj, nil
+}
+
+// shapeAbilities applies fields= to abilities, returning the abilities unchanged if no fields were requested
+func shapeAbilities(abilities Abilities, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return abilities, nil
+	}
+
+	shaped := make([]map[string]any, 0, len(abilities))
+	for i := range abilities {
+		obj, err := toObject(&abilities[i])
+		if err != nil {
+			return nil, err
+		}
+		shaped = append(shaped, project(obj, fields))
+	}
+	return shaped, nil
+}
@@ -0,0 +1,541 @@
+package warscry
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The q= expression language combines field comparisons with AND, OR, NOT and parentheses, e.g.
+//
+//	(runemarks:hero OR runemarks:leader) AND NOT warband:khorne AND wounds>=20
+//
+// Comparisons use the same field names as the query parameters. ':' and '=' test equality
+// (membership for runemark lists, substring for description), '!=' negates it, and
+// '>', '>=', '<', '<=' compare integer characteristics. Weapon characteristics match if any
+// of the fighter's weapons satisfies the comparison; weapon comparisons joined directly by AND
+// must all be satisfied by the same weapon, as with the weapon query parameters.
+
+type fieldKind int
+
+const (
+	stringField  fieldKind = iota // single value, case-insensitive equality
+	listField                     // many values, matches if any value is equal
+	textField                     // free text, matches on case-insensitive substring
+	intField                      // one or more integers, matches if any value satisfies the comparison
+	controlField                  // request option such as sort or limit, not matched against data
+)
+
+// queryField describes how a query field is read from T
+type queryField[T any] struct {
+	kind    fieldKind
+	strings func(t *T) []string
+	ints    func(t *T) []int
+	weapon  bool // values are read one per weapon, in weapon order
+}
+
+func weaponInts(characteristic func(w *Weapon) Characteristic) func(f *Fighter) []int {
+	return func(f *Fighter) []int {
+		values := make([]int, len(f.Weapons))
+		for i := range f.Weapons {
+			values[i] = characteristic(&f.Weapons[i]).Int()
+		}
+		return values
+	}
+}
+
+// fighterQueryFields lists the fields available to q= on /fighters
+var fighterQueryFields = map[string]queryField[Fighter]{
+	"name":           {kind: stringField, strings: func(f *Fighter) []string { return []string{f.Name} }},
+	"_id":            {kind: stringField, strings: func(f *Fighter) []string { return []string{f.Id} }},
+	"warband":        {kind: stringField, strings: func(f *Fighter) []string { return []string{f.FactionRunemark} }},
+	"subfaction":     {kind: stringField, strings: func(f *Fighter) []string { return []string{f.Subfaction} }},
+	"grand_alliance": {kind: stringField, strings: func(f *Fighter) []string { return []string{f.GrandAlliance} }},
+	"runemarks":      {kind: listField, strings: func(f *Fighter) []string { return f.Runemarks }},
+	"weapon_runemark": {kind: listField, weapon: true, strings: func(f *Fighter) []string {
+		runemarks := make([]string, len(f.Weapons))
+		for i := range f.Weapons {
+			runemarks[i] = f.Weapons[i].Runemark
+		}
+		return runemarks
+	}},
+	"movement":  {kind: intField, ints: func(f *Fighter) []int { return []int{f.Movement.Int()} }},
+	"toughness": {kind: intField, ints: func(f *Fighter) []int { return []int{f.Toughness.Int()} }},
+	"wounds":    {kind: intField, ints: func(f *Fighter) []int { return []int{f.Wounds.Int()} }},
+	"points":    {kind: intField, ints: func(f *Fighter) []int { return []int{f.Points.Int()} }},
+	"attacks":   {kind: intField, weapon: true, ints: weaponInts(func(w *Weapon) Characteristic { return w.Attacks })},
+	"strength":  {kind: intField, weapon: true, ints: weaponInts(func(w *Weapon) Characteristic { return w.Strength })},
+	"dmg_hit":   {kind: intField, weapon: true, ints: weaponInts(func(w *Weapon) Characteristic { return w.DamageHit })},
+	"dmg_crit":  {kind: intField, weapon: true, ints: weaponInts(func(w *Weapon) Characteristic { return w.DamageCrit })},
+	"min_range": {kind: intField, weapon: true, ints: weaponInts(func(w *Weapon) Characteristic { return w.MinimumRange })},
+	"max_range": {kind: intField, weapon: true, ints: weaponInts(func(w *Weapon) Characteristic { return w.MaximumRange })},
+}
+
+// abilityQueryFields lists the fields available to q= on /abilities
+var abilityQueryFields = map[string]queryField[Ability]{
+	"_id":         {kind: stringField, strings: func(a *Ability) []string { return []string{a.Id} }},
+	"name":        {kind: stringField, strings: func(a *Ability) []string { return []string{a.Name} }},
+	"warband":     {kind: stringField, strings: func(a *Ability) []string { return []string{a.FactionRunemark} }},
+	"cost":        {kind: stringField, strings: func(a *Ability) []string { return []string{string(a.Type)} }},
+	"description": {kind: textField, strings: func(a *Ability) []string { return []string{a.Description} }},
+	"runemarks":   {kind: listField, strings: func(a *Ability) []string { return a.Runemarks }},
+	"universal":   {kind: stringField, strings: func(a *Ability) []string { return []string{strconv.FormatBool(a.Universal)} }},
+	"effect":      {kind: listField, strings: func(a *Ability) []string { return a.Effects.Keywords }},
+	"target":      {kind: listField, strings: func(a *Ability) []string { return a.Effects.Targets }},
+	"range":       {kind: intField, ints: func(a *Ability) []int { return a.Effects.Ranges }},
+}
+
+// Query is a parsed q= expression that can be evaluated against T
+type Query[T any] struct {
+	root queryNode[T]
+}
+
+// Matches reports whether t satisfies the query; a nil query matches everything
+func (q *Query[T]) Matches(t *T) bool {
+	if q == nil || q.root == nil {
+		return true
+	}
+	return q.root.eval(t)
+}
+
+type queryNode[T any] interface {
+	eval(t *T) bool
+}
+
+type andNode[T any] struct{ left, right queryNode[T] }
+type orNode[T any] struct{ left, right queryNode[T] }
+type notNode[T any] struct{ operand queryNode[T] }
+
+func (n andNode[T]) eval(t *T) bool { return n.left.eval(t) && n.right.eval(t) }
+func (n orNode[T]) eval(t *T) bool  { return n.left.eval(t) || n.right.eval(t) }
+func (n notNode[T]) eval(t *T) bool { return !n.operand.eval(t) }
+
+// stringCompareNode tests a string or list field for equality (or substring for text fields)
+type stringCompareNode[T any] struct {
+	field queryField[T]
+	value string
+}
+
+func (n stringCompareNode[T]) eval(t *T) bool {
+	for _, v := range n.field.strings(t) {
+		if n.match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n stringCompareNode[T]) match(v string) bool {
+	v = strings.ToLower(v)
+	if n.field.kind == textField && strings.Contains(v, n.value) {
+		return true
+	}
+	return v == n.value
+}
+
+func (n stringCompareNode[T]) weaponField() bool { return n.field.weapon }
+
+func (n stringCompareNode[T]) matchEach(t *T) []bool {
+	values := n.field.strings(t)
+	matches := make([]bool, len(values))
+	for i, v := range values {
+		matches[i] = n.match(v)
+	}
+	return matches
+}
+
+// intCompareNode compares an integer field against a value
+type intCompareNode[T any] struct {
+	field queryField[T]
+	op    Operator
+	value int
+}
+
+func (n intCompareNode[T]) eval(t *T) bool {
+	for _, v := range n.field.ints(t) {
+		if n.op(v, n.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n intCompareNode[T]) weaponField() bool { return n.field.weapon }
+
+func (n intCompareNode[T]) matchEach(t *T) []bool {
+	values := n.field.ints(t)
+	matches := make([]bool, len(values))
+	for i, v := range values {
+		matches[i] = n.op(v, n.value)
+	}
+	return matches
+}
+
+// comparisonNode is a single field comparison that can report which of the field's values match
+type comparisonNode[T any] interface {
+	queryNode[T]
+	weaponField() bool
+	matchEach(t *T) []bool
+}
+
+// sameWeaponNode matches if a single weapon satisfies every one of its comparisons
+type sameWeaponNode[T any] struct {
+	comparisons []comparisonNode[T]
+}
+
+func (n sameWeaponNode[T]) eval(t *T) bool {
+	matches := n.comparisons[0].matchEach(t)
+	for _, c := range n.comparisons[1:] {
+		for i, match := range c.matchEach(t) {
+			matches[i] = matches[i] && match
+		}
+	}
+	return slices.Contains(matches, true)
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenEnd
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 1-based character position in the expression
+}
+
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of query"
+	case tokenString:
+		return fmt.Sprintf("\"%s\"", t.text)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+// queryOperators lists the comparison operators, longest first so ">=" is not read as ">"
+var queryOperators = []string{">=", "<=", "!=", ">", "<", ":", "="}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("()\":=!<>", r)
+}
+
+// tokenize splits a q= expression into tokens
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: pos})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, queryError(expression, pos, "unterminated quoted value")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i+1 : end]), pos: pos})
+			i = end + 1
+		case isWordRune(r):
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[i:end]), pos: pos})
+			i = end
+		default:
+			matched := false
+			for _, op := range queryOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: pos})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, queryError(expression, pos, fmt.Sprintf("unexpected character '%c'", r))
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEnd, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+func queryError(expression string, pos int, reason string) QueryError {
+	return QueryError{Parameter: "q", Value: expression, Reason: reason, Position: pos}
+}
+
+// queryParser is a recursive descent parser over the grammar:
+//
+//	or         = and { "OR" and }
+//	and        = not { "AND" not }
+//	not        = "NOT" not | primary
+//	primary    = "(" or ")" | comparison
+//	comparison = field operator value
+type queryParser[T any] struct {
+	expression string
+	tokens     []token
+	pos        int
+	fields     map[string]queryField[T]
+	depth      int // current nesting of parentheses and NOT
+}
+
+// Limits on q= expressions, so a crafted query cannot exhaust the stack or CPU
+const (
+	maxQueryLength = 1024 // total characters across all q= values
+	maxQueryDepth  = 64   // nested parentheses and NOT operators
+)
+
+// enter records one more level of nesting, failing once maxQueryDepth is exceeded; leave undoes it
+func (p *queryParser[T]) enter(t token) error {
+	p.depth++
+	if p.depth > maxQueryDepth {
+		return p.errorAt(t, fmt.Sprintf("expression is nested more than %d levels deep", maxQueryDepth))
+	}
+	return nil
+}
+
+func (p *queryParser[T]) leave() {
+	p.depth--
+}
+
+func (p *queryParser[T]) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser[T]) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser[T]) errorAt(t token, reason string) QueryError {
+	return queryError(p.expression, t.pos, reason)
+}
+
+func (p *queryParser[T]) parseOr() (queryNode[T], error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode[T]{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses a conjunction, grouping its weapon comparisons so they are tested against the same weapon
+func (p *queryParser[T]) parseAnd() (queryNode[T], error) {
+	var operands []queryNode[T]
+	var weapon sameWeaponNode[T]
+	for {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := node.(comparisonNode[T]); ok && c.weaponField() {
+			weapon.comparisons = append(weapon.comparisons, c)
+		} else {
+			operands = append(operands, node)
+		}
+		if !p.peek().is("AND") {
+			break
+		}
+		p.next()
+	}
+
+	switch len(weapon.comparisons) {
+	case 0:
+	case 1:
+		operands = append(operands, weapon.comparisons[0])
+	default:
+		operands = append(operands, weapon)
+	}
+	left := operands[0]
+	for _, right := range operands[1:] {
+		left = andNode[T]{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser[T]) parseNot() (queryNode[T], error) {
+	if t := p.peek(); t.is("NOT") {
+		p.next()
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode[T]{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser[T]) parsePrimary() (queryNode[T], error) {
+	t := p.peek()
+	if t.kind == tokenLeftParen {
+		p.next()
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, p.errorAt(closing, fmt.Sprintf("expected ')' to close '(' at position %d, found %s", t.pos, closing.describe()))
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser[T]) parseComparison() (queryNode[T], error) {
+	fieldToken := p.next()
+	if fieldToken.kind != tokenWord || fieldToken.is("AND") || fieldToken.is("OR") {
+		return nil, p.errorAt(fieldToken, fmt.Sprintf("expected a field name, found %s", fieldToken.describe()))
+	}
+	fieldName := strings.ToLower(fieldToken.text)
+	field, exists := p.fields[fieldName]
+	if !exists {
+		return nil, p.errorAt(fieldToken, fmt.Sprintf("unknown field '%s'", fieldToken.text))
+	}
+
+	opToken := p.next()
+	if opToken.kind != tokenOperator {
+		return nil, p.errorAt(opToken, fmt.Sprintf("expected an operator after '%s', found %s", fieldToken.text, opToken.describe()))
+	}
+
+	valueToken := p.next()
+	if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+		return nil, p.errorAt(valueToken, fmt.Sprintf("expected a value after '%s%s', found %s", fieldToken.text, opToken.text, valueToken.describe()))
+	}
+
+	negate := opToken.text == "!="
+	var node queryNode[T]
+
+	if field.kind == intField {
+		value, err := strconv.Atoi(valueToken.text)
+		if err != nil {
+			return nil, p.errorAt(valueToken, fmt.Sprintf("'%s' requires an integer value, found %s", fieldName, valueToken.describe()))
+		}
+		op := Equals
+		switch opToken.text {
+		case ">":
+			op = GreaterThan
+		case ">=":
+			op = GreaterThanOrEqualTo
+		case "<":
+			op = LessThan
+		case "<=":
+			op = LessThanOrEqualTo
+		}
+		node = intCompareNode[T]{field: field, op: op, value: value}
+	} else {
+		if !slices.Contains([]string{":", "=", "!="}, opToken.text) {
+			return nil, p.errorAt(opToken, fmt.Sprintf("operator '%s' is not supported for text field '%s'", opToken.text, fieldName))
+		}
+		node = stringCompareNode[T]{field: field, value: strings.ToLower(valueToken.text)}
+	}
+
+	if negate {
+		node = notNode[T]{operand: node}
+	}
+	return node, nil
+}
+
+// parseQuery parses one or more q= expressions, combining them with AND
+func parseQuery[T any](expressions []string, fields map[string]queryField[T]) (*Query[T], error) {
+	var root queryNode[T]
+
+	length := 0
+	for _, expression := range expressions {
+		length += len(expression)
+	}
+	if length > maxQueryLength {
+		value := strings.Join(expressions, " ")
+		return nil, QueryError{
+			Parameter: "q",
+			Value:     strings.ToValidUTF8(value[:min(len(value), 32)], "") + "…",
+			Reason:    fmt.Sprintf("expression is longer than %d characters", maxQueryLength),
+		}
+	}
+
+	for _, expression := range expressions {
+		if strings.TrimSpace(expression) == "" {
+			continue
+		}
+		tokens, err := tokenize(expression)
+		if err != nil {
+			return nil, err
+		}
+		p := &queryParser[T]{expression: expression, tokens: tokens, fields: fields}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if trailing := p.peek(); trailing.kind != tokenEnd {
+			return nil, p.errorAt(trailing, fmt.Sprintf("expected AND, OR or end of query, found %s", trailing.describe()))
+		}
+
+		if root == nil {
+			root = node
+		} else {
+			root = andNode[T]{left: root, right: node}
+		}
+	}
+
+	if root == nil {
+		return nil, nil
+	}
+	return &Query[T]{root: root}, nil
+}
+
+// ParseFighterQuery parses q= expressions for /fighters
+func ParseFighterQuery(expressions []string) (*Query[Fighter], error) {
+	return parseQuery(expressions, fighterQueryFields)
+}
+
+// ParseAbilityQuery parses q= expressions for /abilities
+func ParseAbilityQuery(expressions []string) (*Query[Ability], error) {
+	return parseQuery(expressions, abilityQueryFields)
+}
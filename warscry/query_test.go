@@ -0,0 +1,161 @@
+package warscry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var queryTestFighters = Fighters{
+	{
+		Id: "f1", Name: "Lord-Celestant", FactionRunemark: "stormcast-eternals", GrandAlliance: "order",
+		Runemarks: []string{"hero", "leader"}, Movement: 4, Toughness: 5, Wounds: 25, Points: 190,
+		Weapons: []Weapon{{Runemark: "sword", MaximumRange: 1, Attacks: 5, Strength: 4, DamageHit: 2, DamageCrit: 5}},
+	},
+	{
+		Id: "f2", Name: "Prosecutor", FactionRunemark: "stormcast-eternals", GrandAlliance: "order",
+		Runemarks: []string{"fly", "warrior"}, Movement: 12, Toughness: 4, Wounds: 15, Points: 150,
+		Weapons: []Weapon{
+			{Runemark: "ranged-weapon", MinimumRange: 3, MaximumRange: 12, Attacks: 2, Strength: 3, DamageHit: 2, DamageCrit: 4},
+			{Runemark: "sword", MaximumRange: 1, Attacks: 3, Strength: 3, DamageHit: 1, DamageCrit: 3},
+		},
+	},
+	{
+		Id: "f3", Name: "Mighty Lord of Khorne", FactionRunemark: "khorne", GrandAlliance: "chaos",
+		Runemarks: []string{"hero", "leader"}, Movement: 4, Toughness: 5, Wounds: 28, Points: 200,
+		Weapons: []Weapon{{Runemark: "axe", MaximumRange: 1, Attacks: 5, Strength: 5, DamageHit: 2, DamageCrit: 6}},
+	},
+	{
+		Id: "f4", Name: "Bloodreaver", FactionRunemark: "khorne", GrandAlliance: "chaos",
+		Runemarks: []string{"berserker"}, Movement: 4, Toughness: 3, Wounds: 8, Points: 60,
+		Weapons: []Weapon{{Runemark: "axe", MaximumRange: 1, Attacks: 3, Strength: 3, DamageHit: 1, DamageCrit: 3}},
+	},
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		expressions []string
+		want        []string // ids of matching fighters
+	}{
+		{"no expression", nil, []string{"f1", "f2", "f3", "f4"}},
+		{"blank expression", []string{"  "}, []string{"f1", "f2", "f3", "f4"}},
+		{"string equality", []string{"warband:khorne"}, []string{"f3", "f4"}},
+		{"equals sign", []string{"warband=KHORNE"}, []string{"f3", "f4"}},
+		{"quoted value", []string{`name:"mighty lord of khorne"`}, []string{"f3"}},
+		{"not equal", []string{"warband!=khorne"}, []string{"f1", "f2"}},
+		{"list membership", []string{"runemarks:hero"}, []string{"f1", "f3"}},
+		{"integer comparison", []string{"wounds>=25"}, []string{"f1", "f3"}},
+		{"integer less than", []string{"points<100"}, []string{"f4"}},
+		{"any weapon", []string{"max_range>1"}, []string{"f2"}},
+		{"weapon comparisons share a weapon", []string{"max_range>1 AND attacks>=3"}, nil},
+		{"weapon runemark shares a weapon", []string{"weapon_runemark:sword AND attacks<3"}, nil},
+		{"same weapon around other comparisons", []string{"attacks>=3 AND runemarks:fly AND max_range<=1"}, []string{"f2"}},
+		{"weapon comparison under or is not grouped", []string{"(max_range>1 OR runemarks:hero) AND attacks>=3"}, []string{"f1", "f2", "f3"}},
+		{"and", []string{"runemarks:hero AND warband:khorne"}, []string{"f3"}},
+		{"or", []string{"runemarks:fly OR runemarks:berserker"}, []string{"f2", "f4"}},
+		{"not", []string{"NOT runemarks:hero"}, []string{"f2", "f4"}},
+		{"and binds tighter than or", []string{"warband:khorne OR runemarks:fly AND wounds>20"}, []string{"f3", "f4"}},
+		{"parentheses", []string{"(warband:khorne OR runemarks:fly) AND wounds<20"}, []string{"f2", "f4"}},
+		{"lower-case keywords", []string{"not warband:khorne and movement>4"}, []string{"f2"}},
+		{"expressions are combined with and", []string{"warband:khorne", "points>100"}, []string{"f3"}},
+		{"double negation", []string{"NOT NOT runemarks:leader"}, []string{"f1", "f3"}},
+		{"nested to the limit", []string{strings.Repeat("(", maxQueryDepth) + "warband:khorne" + strings.Repeat(")", maxQueryDepth)}, []string{"f3", "f4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseFighterQuery(tt.expressions)
+			if err != nil {
+				t.Fatalf("ParseFighterQuery(%q) returned error: %v", tt.expressions, err)
+			}
+			var got []string
+			for i := range queryTestFighters {
+				if query.Matches(&queryTestFighters[i]) {
+					got = append(got, queryTestFighters[i].Id)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParseFighterQuery(%q) matched %v, want %v", tt.expressions, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		expressions []string
+		reason      string
+		position    int
+	}{
+		{"unknown field", []string{"colour:red"}, "unknown field 'colour'", 1},
+		{"missing operator", []string{"warband khorne"}, "expected an operator after 'warband'", 9},
+		{"missing value", []string{"warband:"}, "expected a value after 'warband:'", 9},
+		{"integer field with text", []string{"wounds>lots"}, "'wounds' requires an integer value", 8},
+		{"comparison on a text field", []string{"warband>khorne"}, "operator '>' is not supported", 8},
+		{"unclosed parenthesis", []string{"(warband:khorne"}, "expected ')' to close '(' at position 1", 16},
+		{"unterminated quote", []string{`name:"lord`}, "unterminated quoted value", 6},
+		{"unexpected character", []string{"warband:khorne!"}, "unexpected character '!'", 15},
+		{"trailing token", []string{"warband:khorne wounds>1"}, "expected AND, OR or end of query", 16},
+		{"dangling and", []string{"warband:khorne AND"}, "expected a field name, found end of query", 19},
+		{"error in a later expression", []string{"warband:khorne", "wounds>"}, "expected a value after 'wounds>'", 8},
+		{"parentheses nested too deep", []string{strings.Repeat("(", maxQueryDepth+1) + "warband:khorne" + strings.Repeat(")", maxQueryDepth+1)}, "nested more than 64 levels deep", maxQueryDepth + 1},
+		{"not nested too deep", []string{strings.Repeat("NOT ", maxQueryDepth+1) + "warband:khorne"}, "nested more than 64 levels deep", 4*maxQueryDepth + 1},
+		{"too long", []string{"name:" + strings.Repeat("a", maxQueryLength)}, "longer than 1024 characters", 0},
+		{"too long across expressions", []string{strings.Repeat("a", maxQueryLength/2), strings.Repeat("b", maxQueryLength/2+1)}, "longer than 1024 characters", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFighterQuery(tt.expressions)
+			var queryErr QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("ParseFighterQuery(%q) returned %v, want a QueryError", tt.expressions, err)
+			}
+			if queryErr.Parameter != "q" {
+				t.Errorf("Parameter = %q, want q", queryErr.Parameter)
+			}
+			if !strings.Contains(queryErr.Reason, tt.reason) {
+				t.Errorf("Reason = %q, want it to contain %q", queryErr.Reason, tt.reason)
+			}
+			if queryErr.Position != tt.position {
+				t.Errorf("Position = %d, want %d", queryErr.Position, tt.position)
+			}
+		})
+	}
+}
+
+func TestParseAbilityQuery(t *testing.T) {
+	abilities := Abilities{
+		{Id: "a1", Name: "Rush", Type: "double", FactionRunemark: "universal", Universal: true, Description: "This fighter makes a bonus move action."},
+		{Id: "a2", Name: "Lightning Strike", Type: "triple", FactionRunemark: "stormcast-eternals", Runemarks: []string{"hero"}, Description: "Pick a visible enemy fighter within 12\"."},
+	}
+	tests := []struct {
+		expression string
+		want       []string
+	}{
+		{"description:bonus", []string{"a1"}},
+		{"universal:true", []string{"a1"}},
+		{"cost:triple OR runemarks:hero", []string{"a2"}},
+		{"NOT description:move", []string{"a2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			query, err := ParseAbilityQuery([]string{tt.expression})
+			if err != nil {
+				t.Fatalf("ParseAbilityQuery(%q) returned error: %v", tt.expression, err)
+			}
+			var got []string
+			for i := range abilities {
+				if query.Matches(&abilities[i]) {
+					got = append(got, abilities[i].Id)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParseAbilityQuery(%q) matched %v, want %v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
@@ -11,8 +11,9 @@ import (
 )
 
 const (
-	FightersURL  = "https://krisling049.github.io/warcry_data/fighters.json"
-	AbilitiesURL = "https://krisling049.github.io/warcry_data/abilities_battletraits.json"
+	DataSourceURL = "https://krisling049.github.io/warcry_data/"
+	FightersURL   = DataSourceURL + "fighters.json"
+	AbilitiesURL  = DataSourceURL + "abilities_battletraits.json"
 )
 
 // RefreshConfig controls data refresh behavior
@@ -105,14 +106,15 @@ func (cfg *RefreshConfig) checkAndRefresh(state *RefreshState) {
 	warbands := LoadWarbands(&fighters, &abilities)
 
 	// Atomic update
-	cfg.DataStore.LoadData(&fighters, &abilities, warbands)
+	cfg.DataStore.LoadData(&fighters, &abilities, warbands, DataSourceURL)
 
 	// Update state on success
 	state.fightersETag = newFightersETag
 	state.abilitiesETag = newAbilitiesETag
 
-	fCount, aCount := cfg.DataStore.GetCounts()
-	log.Printf("data refresh complete (%d fighters, %d abilities)", fCount, aCount)
+	snap := cfg.DataStore.Snapshot()
+	fCount, aCount := snap.GetCounts()
+	log.Printf("data refresh complete (%d fighters, %d abilities, version %d, hash %s)", fCount, aCount, snap.Version, snap.Hash)
 }
 
 // hasChanged performs HEAD request and compares ETag
@@ -183,12 +185,16 @@ func (cfg *RefreshConfig) loadDataSources() (Fighters, Abilities, error) {
 		return fighters, abilities, fmt.Errorf("unmarshal abilities: %w", err)
 	}
 
-	// Validate abilities
+	// Validate abilities, skipping invalid ones as the initial load does
+	valid := abilities[:0]
 	for i, ability := range abilities {
 		if err := ability.Validate(); err != nil {
-			return fighters, abilities, fmt.Errorf("invalid ability at index %d: %w", i, err)
+			log.Printf("skipping invalid ability at index %d: %v", i, err)
+			continue
 		}
+		valid = append(valid, ability)
 	}
+	abilities = valid
 
 	return fighters, abilities, nil
 }
@@ -0,0 +1,264 @@
+package warscry
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rosterCodeVersion is the current roster code format, written before the first "." of every code
+const rosterCodeVersion = 1
+
+// maxRosterCodeLength bounds the length of roster codes accepted for decoding
+const maxRosterCodeLength = 4096
+
+// maxRosterPayloadBytes bounds the decompressed size of a roster code payload
+const maxRosterPayloadBytes = 64 * 1024
+
+// Kinds of change flagged on fighters of a decoded roster
+const (
+	ChangePoints  = "points_changed"
+	ChangeProfile = "profile_changed"
+	ChangeRemoved = "removed"
+)
+
+// RosterCode is the shareable code for an encoded roster
+type RosterCode struct {
+	Code     string `json:"code"`
+	DataHash string `json:"data_hash"`
+}
+
+// RosterChange flags a fighter whose data changed since its roster code was made
+type RosterChange struct {
+	FighterId     FighterID `json:"fighter_id"`
+	Change        string    `json:"change"`
+	EncodedPoints int       `json:"encoded_points"`
+	CurrentPoints int       `json:"current_points"`
+}
+
+// DecodedRoster is a roster decoded from a code, validated against the current data
+type DecodedRoster struct {
+	RosterValidation
+	Code        string         `json:"code"`
+	DataHash    string         `json:"data_hash"`    // hash of the data the code was made with
+	CurrentHash string         `json:"current_hash"` // hash of the data the roster was validated with
+	DataChanged bool           `json:"data_changed"` // the hashes differ
+	Changes     []RosterChange `json:"changes"`
+}
+
+// codedFighter is a fighter entry of a roster code, with the points and profile checksum it was encoded with
+type codedFighter struct {
+	Id       FighterID
+	Count    int
+	Points   int
+	Checksum uint32
+}
+
+// ProfileChecksum summarises the fighter's name, runemarks, characteristics and weapons, excluding points
+func (f *Fighter) ProfileChecksum() uint32 {
+	profile := struct {
+		Name      FighterName
+		Runemarks []Runemark
+		Movement  Characteristic
+		Toughness Characteristic
+		Wounds    Characteristic
+		Weapons   []Weapon
+	}{f.Name, f.Runemarks, f.Movement, f.Toughness, f.Wounds, f.Weapons}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return 0
+	}
+	return crc32.ChecksumIEEE(data)
+}
+
+// EncodeRoster builds a roster code from a validated roster. The payload is one line each for the warband,
+// subfaction, points limit and data hash, then one id:count:points:checksum line per fighter, followed by
+// a CRC-32 of the payload, deflated and base64url encoded.
+func EncodeRoster(validation RosterValidation, dataHash string) (string, error) {
+	if strings.Contains(validation.Warband, "\n") {
+		return "", fmt.Errorf("warband '%s' cannot be encoded", validation.Warband)
+	}
+	if strings.Contains(validation.Subfaction, "\n") {
+		return "", fmt.Errorf("subfaction '%s' cannot be encoded", validation.Subfaction)
+	}
+	var payload bytes.Buffer
+	fmt.Fprintf(&payload, "%s\n%s\n%d\n%s\n", validation.Warband, validation.Subfaction, validation.PointsLimit, dataHash)
+	for i := range validation.Fighters {
+		rf := &validation.Fighters[i]
+		if strings.ContainsAny(rf.Id, ":\n") {
+			return "", fmt.Errorf("fighter id '%s' cannot be encoded", rf.Id)
+		}
+		fmt.Fprintf(&payload, "%s:%d:%d:%d\n", rf.Id, rf.Count, rf.Points.Int(), rf.ProfileChecksum())
+	}
+	payload.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(payload.Bytes())))
+
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(payload.Bytes()); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%s", rosterCodeVersion, base64.RawURLEncoding.EncodeToString(compressed.Bytes())), nil
+}
+
+// DecodeRoster parses a roster code back into a roster, the data hash it was made with and its fighter entries
+func DecodeRoster(code string) (Roster, string, []codedFighter, error) {
+	if len(code) > maxRosterCodeLength {
+		return Roster{}, "", nil, fmt.Errorf("roster code is longer than %d characters", maxRosterCodeLength)
+	}
+	version, encoded, found := strings.Cut(code, ".")
+	if !found {
+		return Roster{}, "", nil, errors.New("roster code has no version")
+	}
+	if version != strconv.Itoa(rosterCodeVersion) {
+		return Roster{}, "", nil, fmt.Errorf("unsupported roster code version '%s'", version)
+	}
+
+	compressed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Roster{}, "", nil, errors.New("roster code is not valid base64url")
+	}
+	payload, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxRosterPayloadBytes+1))
+	if err != nil || len(payload) > maxRosterPayloadBytes || len(payload) < 4 {
+		return Roster{}, "", nil, errors.New("roster code is corrupt")
+	}
+	body, checksum := payload[:len(payload)-4], binary.BigEndian.Uint32(payload[len(payload)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return Roster{}, "", nil, errors.New("roster code checksum does not match")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) < 4 {
+		return Roster{}, "", nil, errors.New("roster code is missing fields")
+	}
+	roster := Roster{Warband: lines[0], Subfaction: lines[1]}
+	if roster.PointsLimit, err = strconv.Atoi(lines[2]); err != nil {
+		return Roster{}, "", nil, errors.New("roster code has an invalid points limit")
+	}
+	dataHash := lines[3]
+	if _, err := hex.DecodeString(dataHash); err != nil || dataHash == "" {
+		return Roster{}, "", nil, errors.New("roster code has an invalid data hash")
+	}
+
+	var fighters []codedFighter
+	for _, line := range lines[4:] {
+		parts := strings.Split(line, ":")
+		if len(parts) != 4 {
+			return Roster{}, "", nil, fmt.Errorf("roster code has an invalid fighter entry '%s'", line)
+		}
+		count, countErr := strconv.Atoi(parts[1])
+		points, pointsErr := strconv.Atoi(parts[2])
+		sum, sumErr := strconv.ParseUint(parts[3], 10, 32)
+		if err := errors.Join(countErr, pointsErr, sumErr); err != nil {
+			return Roster{}, "", nil, fmt.Errorf("roster code has an invalid fighter entry '%s'", line)
+		}
+		fighters = append(fighters, codedFighter{Id: parts[0], Count: count, Points: points, Checksum: uint32(sum)})
+		roster.Fighters = append(roster.Fighters, RosterEntry{FighterId: parts[0], Count: count})
+	}
+	return roster, dataHash, fighters, nil
+}
+
+// rosterChanges compares the fighters of a roster code against the current data
+func rosterChanges(coded []codedFighter, snap *Snapshot) []RosterChange {
+	changes := []RosterChange{}
+	for _, c := range coded {
+		fighter, exists := snap.GetFighter(c.Id)
+		switch {
+		case !exists:
+			changes = append(changes, RosterChange{FighterId: c.Id, Change: ChangeRemoved, EncodedPoints: c.Points})
+		case fighter.Points.Int() != c.Points:
+			changes = append(changes, RosterChange{
+				FighterId: c.Id, Change: ChangePoints, EncodedPoints: c.Points, CurrentPoints: fighter.Points.Int(),
+			})
+		}
+		if exists && fighter.ProfileChecksum() != c.Checksum {
+			changes = append(changes, RosterChange{
+				FighterId: c.Id, Change: ChangeProfile, EncodedPoints: c.Points, CurrentPoints: fighter.Points.Int(),
+			})
+		}
+	}
+	return changes
+}
+
+// serveEncode handles POST /rosters/encode
+func (h *RosterHandler) serveEncode(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Step 1: Parse request body
+	var roster Roster
+	if err := decodeJSONBody(w, r, &roster); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if roster.PointsLimit < 0 {
+		err := fmt.Errorf("points_limit cannot be negative, got %d", roster.PointsLimit)
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Resolve fighters; rule violations can be encoded, but unknown fighters and bad counts can't
+	validation := ValidateRoster(roster, snap, h.rules())
+	if err := validation.ResolveError(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Encode
+	code, err := EncodeRoster(validation, snap.Hash)
+	if err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	log.Printf("encoded roster of %d fighters for %s", validation.FighterCount, r.RemoteAddr)
+	writeJSON(w, RosterCode{Code: code, DataHash: snap.Hash})
+}
+
+// serveDecode handles GET /rosters/{code}
+func (h *RosterHandler) serveDecode(w http.ResponseWriter, r *http.Request, snap *Snapshot, code string) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	// Step 1: Decode and verify the code
+	roster, dataHash, coded, err := DecodeRoster(code)
+	if err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("invalid roster code: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate against current data, flagging fighters that changed since the code was made
+	decoded := DecodedRoster{
+		RosterValidation: ValidateRoster(roster, snap, h.rules()),
+		Code:             code,
+		DataHash:         dataHash,
+		CurrentHash:      snap.Hash,
+		DataChanged:      dataHash != snap.Hash,
+		Changes:          rosterChanges(coded, snap),
+	}
+	log.Printf("decoded roster of %d fighters for %s (%d changes)", decoded.FighterCount, r.RemoteAddr, len(decoded.Changes))
+	writeJSON(w, decoded)
+}
@@ -0,0 +1,182 @@
+package warscry
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rawRosterCode builds a roster code of the given version around a hand-written payload, with a valid checksum
+func rawRosterCode(t *testing.T, version int, body string) string {
+	t.Helper()
+	payload := binary.BigEndian.AppendUint32([]byte(body), crc32.ChecksumIEEE([]byte(body)))
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	if _, err := writer.Write(payload); err != nil {
+		t.Fatalf("compressing payload: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("compressing payload: %v", err)
+	}
+	return fmt.Sprintf("%d.%s", version, base64.RawURLEncoding.EncodeToString(compressed.Bytes()))
+}
+
+func TestRosterCodeRoundTrip(t *testing.T) {
+	snap := rosterTestSnapshot()
+
+	tests := []struct {
+		name   string
+		roster Roster
+	}{
+		{"single fighter", Roster{Fighters: entries("f1")}},
+		{"counts", Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2", Count: 3}, {FighterId: "f3", Count: 2}}}},
+		{"subfaction", Roster{Warband: "khorne", Subfaction: "magores-fiends", Fighters: entries("f6", "f7", "f8")}},
+		{"points limit", Roster{PointsLimit: 500, Fighters: entries("f5", "f4", "f9")}},
+		{"invalid roster", Roster{Fighters: []RosterEntry{{FighterId: "f1", Count: 2}, {FighterId: "f4"}}}},
+		{"no fighters", Roster{Warband: "khorne"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validation := ValidateRoster(tt.roster, snap, DefaultRosterRules)
+			code, err := EncodeRoster(validation, snap.Hash)
+			if err != nil {
+				t.Fatalf("EncodeRoster returned error: %v", err)
+			}
+			if !strings.HasPrefix(code, fmt.Sprintf("%d.", rosterCodeVersion)) {
+				t.Errorf("code %q does not start with version %d", code, rosterCodeVersion)
+			}
+
+			roster, dataHash, coded, err := DecodeRoster(code)
+			if err != nil {
+				t.Fatalf("DecodeRoster(%q) returned error: %v", code, err)
+			}
+			if dataHash != snap.Hash {
+				t.Errorf("data hash = %q, want %q", dataHash, snap.Hash)
+			}
+			if roster.Warband != validation.Warband || roster.Subfaction != validation.Subfaction || roster.PointsLimit != validation.PointsLimit {
+				t.Errorf("decoded %q/%q/%d, want %q/%q/%d", roster.Warband, roster.Subfaction, roster.PointsLimit,
+					validation.Warband, validation.Subfaction, validation.PointsLimit)
+			}
+
+			var want []RosterEntry
+			for _, rf := range validation.Fighters {
+				want = append(want, RosterEntry{FighterId: rf.Id, Count: rf.Count})
+			}
+			if !slices.Equal(roster.Fighters, want) {
+				t.Errorf("decoded fighters %v, want %v", roster.Fighters, want)
+			}
+			for i, c := range coded {
+				rf := validation.Fighters[i]
+				if c.Points != rf.Points.Int() || c.Checksum != rf.ProfileChecksum() {
+					t.Errorf("fighter %s decoded with points %d and checksum %d, want %d and %d",
+						c.Id, c.Points, c.Checksum, rf.Points.Int(), rf.ProfileChecksum())
+				}
+			}
+
+			// the decoded roster validates to the same result
+			if again := ValidateRoster(roster, snap, DefaultRosterRules); again.Points != validation.Points || again.Valid != validation.Valid {
+				t.Errorf("revalidated to %d points, valid %v, want %d, valid %v", again.Points, again.Valid, validation.Points, validation.Valid)
+			}
+		})
+	}
+}
+
+func TestDecodeRosterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"too long", "1." + strings.Repeat("a", maxRosterCodeLength), "longer than"},
+		{"no version", "abc", "has no version"},
+		{"unsupported version", "2.abc", "unsupported roster code version '2'"},
+		{"not base64url", "1.a+b/c", "not valid base64url"},
+		{"not deflated", "1." + base64.RawURLEncoding.EncodeToString([]byte("roster")), "corrupt"},
+		{"missing fields", rawRosterCode(t, 1, "khorne\n\n1000\n"), "missing fields"},
+		{"invalid points limit", rawRosterCode(t, 1, "khorne\n\nlots\nabcd\n"), "invalid points limit"},
+		{"invalid data hash", rawRosterCode(t, 1, "khorne\n\n1000\nnot-hex\n"), "invalid data hash"},
+		{"empty data hash", rawRosterCode(t, 1, "khorne\n\n1000\n\nf5:1:200:1\n"), "invalid data hash"},
+		{"short fighter entry", rawRosterCode(t, 1, "khorne\n\n1000\nabcd\nf5:1:200\n"), "invalid fighter entry 'f5:1:200'"},
+		{"non-numeric fighter entry", rawRosterCode(t, 1, "khorne\n\n1000\nabcd\nf5:one:200:1\n"), "invalid fighter entry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := DecodeRoster(tt.code)
+			if err == nil {
+				t.Fatalf("DecodeRoster(%q) returned no error", tt.code)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodeRoster(%q) = %v, want an error containing %q", tt.code, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRosterChecksum(t *testing.T) {
+	// a valid deflate stream whose trailing CRC-32 doesn't match the body
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	writer.Write([]byte("khorne\n\n1000\nabcd\n\x00\x00\x00\x00"))
+	writer.Close()
+
+	_, _, _, err := DecodeRoster("1." + base64.RawURLEncoding.EncodeToString(compressed.Bytes()))
+	if err == nil || !strings.Contains(err.Error(), "checksum does not match") {
+		t.Errorf("DecodeRoster returned %v, want a checksum error", err)
+	}
+}
+
+func TestEncodeRosterRejectsUnencodableFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		validation RosterValidation
+	}{
+		{"fighter id with ':'", RosterValidation{Warband: "khorne", Fighters: []RosterFighter{{Fighter: Fighter{Id: "f:1"}, Count: 1}}}},
+		{"fighter id with a newline", RosterValidation{Warband: "khorne", Fighters: []RosterFighter{{Fighter: Fighter{Id: "f\n1"}, Count: 1}}}},
+		{"warband with a newline", RosterValidation{Warband: "khorne\n\n5000\nabcd"}},
+		{"subfaction with a newline", RosterValidation{Warband: "khorne", Subfaction: "magores-fiends\n5000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, err := EncodeRoster(tt.validation, "abcd"); err == nil {
+				t.Errorf("EncodeRoster returned %q, want an error", code)
+			}
+		})
+	}
+}
+
+func TestRosterChanges(t *testing.T) {
+	coded := []codedFighter{
+		{Id: "f1", Count: 1, Points: 190},
+		{Id: "f2", Count: 2, Points: 80},
+		{Id: "f3", Count: 1, Points: 150},
+		{Id: "removed", Count: 1, Points: 100},
+	}
+	snap := rosterTestSnapshot()
+	for _, id := range []string{"f1", "f2"} {
+		fighter, _ := snap.GetFighter(id)
+		for i := range coded {
+			if coded[i].Id == id {
+				coded[i].Checksum = fighter.ProfileChecksum()
+			}
+		}
+	}
+
+	// f1 is unchanged, f2's points changed, f3's profile checksum doesn't match and "removed" is gone
+	var got []string
+	for _, c := range rosterChanges(coded, snap) {
+		got = append(got, c.FighterId+":"+c.Change)
+	}
+	want := []string{"f2:" + ChangePoints, "f3:" + ChangeProfile, "removed:" + ChangeRemoved}
+	if !slices.Equal(got, want) {
+		t.Errorf("rosterChanges = %v, want %v", got, want)
+	}
+}
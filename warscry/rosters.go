@@ -0,0 +1,557 @@
+package warscry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Runemarks that carry list-building rules
+const (
+	LeaderRunemark = "leader"
+	HeroRunemark   = "hero"
+	AllyRunemark   = "ally"
+	ThrallRunemark = "thrall"
+)
+
+// Roles a fighter can take in a roster
+const (
+	RoleWarband = "warband"
+	RoleAlly    = "ally"
+	RoleThrall  = "thrall"
+)
+
+// Machine-readable roster violation codes
+const (
+	ViolationUnknownFighter        = "unknown_fighter"
+	ViolationInvalidCount          = "invalid_count"
+	ViolationUnknownWarband        = "unknown_warband"
+	ViolationUnknownSubfaction     = "unknown_subfaction"
+	ViolationPointsExceeded        = "points_exceeded"
+	ViolationMixedFactions         = "mixed_factions"
+	ViolationSubfactionMismatch    = "subfaction_mismatch"
+	ViolationGrandAllianceMismatch = "grand_alliance_mismatch"
+	ViolationNoLeader              = "no_leader"
+	ViolationTooManyLeaders        = "too_many_leaders"
+	ViolationTooManyHeroes         = "too_many_heroes"
+	ViolationDuplicateHero         = "duplicate_hero"
+	ViolationTooManyAllies         = "too_many_allies"
+	ViolationTooManyThralls        = "too_many_thralls"
+	ViolationTooFewFighters        = "too_few_fighters"
+	ViolationTooManyFighters       = "too_many_fighters"
+)
+
+// blockingViolations are the violations adding a fighter can cause; the rest are fixed by adding fighters
+// (too_few_fighters, no_leader) or are problems with the request itself (unknown_fighter, invalid_count)
+var blockingViolations = []string{
+	ViolationUnknownWarband, ViolationUnknownSubfaction, ViolationPointsExceeded, ViolationMixedFactions,
+	ViolationSubfactionMismatch, ViolationGrandAllianceMismatch, ViolationTooManyLeaders, ViolationTooManyHeroes,
+	ViolationDuplicateHero, ViolationTooManyAllies, ViolationTooManyThralls, ViolationTooManyFighters,
+}
+
+// RosterRules holds the configurable list-building limits
+type RosterRules struct {
+	PointsLimit int `json:"points_limit"` // used when a roster doesn't set its own
+	MinFighters int `json:"min_fighters"`
+	MaxFighters int `json:"max_fighters"`
+	Leaders     int `json:"leaders"` // exact number of leader fighters required
+	MaxHeroes   int `json:"max_heroes"`
+	MaxAllies   int `json:"max_allies"`
+	MaxThralls  int `json:"max_thralls"`
+}
+
+// DefaultRosterRules are the matched play list-building limits
+var DefaultRosterRules = RosterRules{
+	PointsLimit: 1000,
+	MinFighters: 3,
+	MaxFighters: 15,
+	Leaders:     1,
+	MaxHeroes:   2,
+	MaxAllies:   1,
+	MaxThralls:  1,
+}
+
+// RosterEntry is a fighter in a roster request, included count times
+type RosterEntry struct {
+	FighterId FighterID `json:"fighter_id"`
+	Count     int       `json:"count,omitempty"` // defaults to 1
+}
+
+// Roster is a warband list submitted for validation
+type Roster struct {
+	Warband     Runemark      `json:"warband,omitempty"`      // inferred from the fighters if empty
+	Subfaction  string        `json:"subfaction,omitempty"`   // restricts the list to one subfaction, e.g. a bladeborn list
+	PointsLimit int           `json:"points_limit,omitempty"` // defaults to the rules' points limit
+	Fighters    []RosterEntry `json:"fighters"`
+}
+
+// RosterFighter is a resolved roster entry
+type RosterFighter struct {
+	Fighter
+	Count int    `json:"count"`
+	Role  string `json:"role"`
+}
+
+// RosterViolation is a single broken list-building rule
+type RosterViolation struct {
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	FighterIds []FighterID `json:"fighter_ids,omitempty"`
+}
+
+// RosterValidation is the result of checking a roster against the list-building rules
+type RosterValidation struct {
+	Valid         bool              `json:"valid"`
+	Warband       Runemark          `json:"warband"`
+	Subfaction    string            `json:"subfaction,omitempty"` // declared, or shared by every warband fighter
+	Bladeborn     bool              `json:"bladeborn"`
+	GrandAlliance string            `json:"grand_alliance"`
+	Points        int               `json:"points"`
+	PointsLimit   int               `json:"points_limit"`
+	FighterCount  int               `json:"fighter_count"`
+	Leaders       int               `json:"leaders"`
+	Heroes        int               `json:"heroes"`
+	Allies        int               `json:"allies"`
+	Thralls       int               `json:"thralls"`
+	Fighters      []RosterFighter   `json:"fighters"`
+	Violations    []RosterViolation `json:"violations"`
+}
+
+// RosterRole returns the role the fighter takes in a roster: an ally, a thrall or a warband fighter
+func (f *Fighter) RosterRole() string {
+	switch {
+	case slices.Contains(f.Runemarks, AllyRunemark):
+		return RoleAlly
+	case slices.Contains(f.Runemarks, ThrallRunemark):
+		return RoleThrall
+	}
+	return RoleWarband
+}
+
+// addViolation records a violation of the list-building rules
+func (v *RosterValidation) addViolation(code string, ids []FighterID, format string, args ...any) {
+	v.Violations = append(v.Violations, RosterViolation{
+		Code:       code,
+		Message:    fmt.Sprintf(format, args...),
+		FighterIds: ids,
+	})
+}
+
+// maxFighterCount bounds how many copies of one fighter a roster can list, well above any legal roster,
+// so points and fighter totals can't overflow and wrap past the limits
+const maxFighterCount = 100
+
+// resolveRoster looks up every roster entry, merging repeated ids and recording unknown fighters and bad counts
+func resolveRoster(roster Roster, snap *Snapshot, result *RosterValidation) {
+	for _, entry := range roster.Fighters {
+		count := entry.Count
+		if count == 0 {
+			count = 1
+		}
+		if count < 0 {
+			result.addViolation(ViolationInvalidCount, []FighterID{entry.FighterId},
+				"fighter '%s' has a negative count: %d", entry.FighterId, count)
+			continue
+		}
+		if count > maxFighterCount {
+			result.addViolation(ViolationInvalidCount, []FighterID{entry.FighterId},
+				"fighter '%s' has a count above %d: %d", entry.FighterId, maxFighterCount, count)
+			continue
+		}
+		fighter, exists := snap.GetFighter(entry.FighterId)
+		if !exists {
+			result.addViolation(ViolationUnknownFighter, []FighterID{entry.FighterId},
+				"fighter '%s' not found", entry.FighterId)
+			continue
+		}
+
+		idx := slices.IndexFunc(result.Fighters, func(rf RosterFighter) bool { return rf.Id == fighter.Id })
+		if idx >= 0 {
+			if total := result.Fighters[idx].Count + count; total > maxFighterCount {
+				result.addViolation(ViolationInvalidCount, []FighterID{entry.FighterId},
+					"fighter '%s' has a total count above %d: %d", entry.FighterId, maxFighterCount, total)
+				continue
+			}
+			result.Fighters[idx].Count += count
+			continue
+		}
+		result.Fighters = append(result.Fighters, RosterFighter{Fighter: fighter, Count: count})
+	}
+}
+
+// ResolveError returns an error if any roster entry couldn't be resolved to a fighter
+func (v *RosterValidation) ResolveError() error {
+	for _, violation := range v.Violations {
+		if violation.Code == ViolationUnknownFighter || violation.Code == ViolationInvalidCount {
+			return errors.New(violation.Message)
+		}
+	}
+	return nil
+}
+
+// inferSubfaction returns the subfaction shared by every warband fighter of the roster, or "" if they don't share one
+func inferSubfaction(fighters []RosterFighter, warband Runemark) string {
+	var subfaction string
+	for i := range fighters {
+		rf := &fighters[i]
+		if rf.RosterRole() != RoleWarband || !strings.EqualFold(rf.FactionRunemark, warband) {
+			continue
+		}
+		if rf.Subfaction == "" || (subfaction != "" && rf.Subfaction != subfaction) {
+			return ""
+		}
+		subfaction = rf.Subfaction
+	}
+	return subfaction
+}
+
+// inferWarband picks the faction of the first fighter that isn't an ally or thrall
+func inferWarband(fighters []RosterFighter) Runemark {
+	for i := range fighters {
+		if rf := &fighters[i]; rf.RosterRole() == RoleWarband {
+			return rf.FactionRunemark
+		}
+	}
+	if len(fighters) > 0 {
+		return fighters[0].FactionRunemark
+	}
+	return ""
+}
+
+// ValidateRoster resolves a roster against the current data and checks it against the list-building rules,
+// reporting every violation rather than stopping at the first
+func ValidateRoster(roster Roster, snap *Snapshot, rules RosterRules) RosterValidation {
+	result := RosterValidation{
+		PointsLimit: roster.PointsLimit,
+		Subfaction:  roster.Subfaction,
+		Fighters:    []RosterFighter{},
+		Violations:  []RosterViolation{},
+	}
+	if result.PointsLimit == 0 {
+		result.PointsLimit = rules.PointsLimit
+	}
+
+	// Step 1: Resolve fighters
+	resolveRoster(roster, snap, &result)
+
+	// Step 2: Work out which warband the roster belongs to
+	result.Warband = roster.Warband
+	if result.Warband == "" {
+		result.Warband = inferWarband(result.Fighters)
+	}
+	warbands := snap.GetWarbands()
+	var subfaction *Subfaction
+	if warband := warbands.GetWarband(result.Warband); warband != nil {
+		result.Warband = warband.Name
+		result.GrandAlliance = warband.GrandAlliance
+		if roster.Subfaction != "" {
+			if subfaction = warband.GetSubfaction(roster.Subfaction); subfaction == nil {
+				result.addViolation(ViolationUnknownSubfaction, nil,
+					"warband '%s' has no subfaction '%s'", warband.Name, roster.Subfaction)
+			}
+		} else {
+			subfaction = warband.GetSubfaction(inferSubfaction(result.Fighters, warband.Name))
+		}
+	} else if result.Warband != "" {
+		result.addViolation(ViolationUnknownWarband, nil, "warband '%s' not found", result.Warband)
+	}
+	if subfaction != nil {
+		result.Subfaction = subfaction.Runemark
+		result.Bladeborn = subfaction.Bladeborn
+	}
+
+	// Step 3: Tally points and roles, checking each fighter belongs in the roster
+	var mixed, wrongSubfaction, wrongAlliance, duplicateHeroes, heroes, leaders []FighterID
+	for i := range result.Fighters {
+		rf := &result.Fighters[i]
+		rf.Role = rf.RosterRole()
+
+		result.Points += rf.Points.Int() * rf.Count
+		result.FighterCount += rf.Count
+		if slices.Contains(rf.Runemarks, LeaderRunemark) {
+			result.Leaders += rf.Count
+			leaders = append(leaders, rf.Id)
+		}
+		if slices.Contains(rf.Runemarks, HeroRunemark) {
+			result.Heroes += rf.Count
+			heroes = append(heroes, rf.Id)
+			if rf.Count > 1 {
+				duplicateHeroes = append(duplicateHeroes, rf.Id)
+			}
+		}
+
+		switch rf.Role {
+		case RoleAlly, RoleThrall:
+			if rf.Role == RoleAlly {
+				result.Allies += rf.Count
+			} else {
+				result.Thralls += rf.Count
+			}
+			if result.GrandAlliance != "" && !strings.EqualFold(rf.GrandAlliance, result.GrandAlliance) {
+				wrongAlliance = append(wrongAlliance, rf.Id)
+			}
+		default:
+			if !strings.EqualFold(rf.FactionRunemark, result.Warband) {
+				mixed = append(mixed, rf.Id)
+			} else if roster.Subfaction != "" && !strings.EqualFold(rf.Subfaction, result.Subfaction) {
+				wrongSubfaction = append(wrongSubfaction, rf.Id)
+			}
+		}
+	}
+
+	// Step 4: Check the roster as a whole
+	if result.Points > result.PointsLimit {
+		result.addViolation(ViolationPointsExceeded, nil,
+			"roster costs %d points, over the %d point limit", result.Points, result.PointsLimit)
+	}
+	if len(mixed) > 0 {
+		result.addViolation(ViolationMixedFactions, mixed,
+			"fighters from outside '%s' must be allies or thralls", result.Warband)
+	}
+	if len(wrongSubfaction) > 0 {
+		result.addViolation(ViolationSubfactionMismatch, wrongSubfaction,
+			"fighters must belong to subfaction '%s'", roster.Subfaction)
+	}
+	if len(wrongAlliance) > 0 {
+		result.addViolation(ViolationGrandAllianceMismatch, wrongAlliance,
+			"allies and thralls must share the warband's grand alliance '%s'", result.GrandAlliance)
+	}
+	if result.Leaders < rules.Leaders {
+		result.addViolation(ViolationNoLeader, nil,
+			"roster needs %d leader, has %d", rules.Leaders, result.Leaders)
+	}
+	if result.Leaders > rules.Leaders {
+		result.addViolation(ViolationTooManyLeaders, leaders,
+			"roster can have %d leader, has %d", rules.Leaders, result.Leaders)
+	}
+	// subfactions made up only of heroes aren't held to the hero limit
+	if result.Heroes > rules.MaxHeroes && (subfaction == nil || !subfaction.HeroesAll) {
+		result.addViolation(ViolationTooManyHeroes, heroes,
+			"roster can have at most %d heroes, has %d", rules.MaxHeroes, result.Heroes)
+	}
+	if len(duplicateHeroes) > 0 {
+		result.addViolation(ViolationDuplicateHero, duplicateHeroes, "each hero can only be included once")
+	}
+	if result.Allies > rules.MaxAllies {
+		result.addViolation(ViolationTooManyAllies, nil,
+			"roster can have at most %d allies, has %d", rules.MaxAllies, result.Allies)
+	}
+	if result.Thralls > rules.MaxThralls {
+		result.addViolation(ViolationTooManyThralls, nil,
+			"roster can have at most %d thralls, has %d", rules.MaxThralls, result.Thralls)
+	}
+	if result.FighterCount < rules.MinFighters {
+		result.addViolation(ViolationTooFewFighters, nil,
+			"roster needs at least %d fighters, has %d", rules.MinFighters, result.FighterCount)
+	}
+	if result.FighterCount > rules.MaxFighters {
+		result.addViolation(ViolationTooManyFighters, nil,
+			"roster can have at most %d fighters, has %d", rules.MaxFighters, result.FighterCount)
+	}
+
+	result.Valid = len(result.Violations) == 0
+	return result
+}
+
+// IneligibleFighter is a fighter that can't be added to a roster, with the rules adding it would break
+type IneligibleFighter struct {
+	Id      FighterID         `json:"_id"`
+	Name    FighterName       `json:"name"`
+	Points  int               `json:"points"`
+	Reasons []RosterViolation `json:"reasons"`
+}
+
+// RosterOptionGroup lists the eligible and ineligible fighters of one warband or subfaction
+type RosterOptionGroup struct {
+	Warband    Runemark            `json:"warband"`
+	Subfaction string              `json:"subfaction,omitempty"`
+	Bladeborn  bool                `json:"bladeborn"`
+	HeroesAll  bool                `json:"heroes_all"`
+	Eligible   Fighters            `json:"eligible"`
+	Ineligible []IneligibleFighter `json:"ineligible"`
+}
+
+// RosterOptions is the set of fighters that can still legally be added to a partial roster
+type RosterOptions struct {
+	Warband               Runemark            `json:"warband"`
+	Points                int                 `json:"points"`
+	PointsLimit           int                 `json:"points_limit"`
+	RemainingPoints       int                 `json:"remaining_points"`
+	RemainingHeroSlots    int                 `json:"remaining_hero_slots"`
+	RemainingFighterSlots int                 `json:"remaining_fighter_slots"`
+	Violations            []RosterViolation   `json:"violations"` // rules the partial roster already breaks
+	Groups                []RosterOptionGroup `json:"groups"`
+}
+
+// additionViolations returns the blocking violations caused by adding one more of the fighter to the roster
+func additionViolations(roster Roster, f *Fighter, snap *Snapshot, rules RosterRules) []RosterViolation {
+	roster.Fighters = append(slices.Clip(roster.Fighters), RosterEntry{FighterId: f.Id, Count: 1})
+	validation := ValidateRoster(roster, snap, rules)
+
+	var reasons []RosterViolation
+	for _, v := range validation.Violations {
+		if slices.Contains(blockingViolations, v.Code) {
+			reasons = append(reasons, v)
+		}
+	}
+	return reasons
+}
+
+// RosterAdditions checks which candidate fighters could be added to a partial roster, grouped in the
+// warband and subfaction order of LoadWarbands
+func RosterAdditions(roster Roster, candidates Fighters, snap *Snapshot, rules RosterRules) RosterOptions {
+	current := ValidateRoster(roster, snap, rules)
+	options := RosterOptions{
+		Warband:               current.Warband,
+		Points:                current.Points,
+		PointsLimit:           current.PointsLimit,
+		RemainingPoints:       current.PointsLimit - current.Points,
+		RemainingHeroSlots:    max(rules.MaxHeroes-current.Heroes, 0),
+		RemainingFighterSlots: max(rules.MaxFighters-current.FighterCount, 0),
+		Violations:            current.Violations,
+		Groups:                []RosterOptionGroup{},
+	}
+
+	candidateIds := make(map[FighterID]bool, len(candidates))
+	for _, f := range candidates {
+		candidateIds[f.Id] = true
+	}
+
+	for _, warband := range snap.GetWarbands() {
+		var groups []RosterOptionGroup
+		for i := range warband.Fighters {
+			f := &warband.Fighters[i]
+			if !candidateIds[f.Id] {
+				continue
+			}
+
+			idx := slices.IndexFunc(groups, func(g RosterOptionGroup) bool { return g.Subfaction == f.Subfaction })
+			if idx < 0 {
+				group := RosterOptionGroup{
+					Warband:    warband.Name,
+					Subfaction: f.Subfaction,
+					Eligible:   Fighters{},
+					Ineligible: []IneligibleFighter{},
+				}
+				if s := warband.GetSubfaction(f.Subfaction); s != nil {
+					group.Bladeborn = s.Bladeborn
+					group.HeroesAll = s.HeroesAll
+				}
+				groups = append(groups, group)
+				idx = len(groups) - 1
+			}
+
+			if reasons := additionViolations(roster, f, snap, rules); len(reasons) > 0 {
+				groups[idx].Ineligible = append(groups[idx].Ineligible, IneligibleFighter{
+					Id:      f.Id,
+					Name:    f.Name,
+					Points:  f.Points.Int(),
+					Reasons: reasons,
+				})
+			} else {
+				groups[idx].Eligible = append(groups[idx].Eligible, *f)
+			}
+		}
+		options.Groups = append(options.Groups, groups...)
+	}
+	return options
+}
+
+type RosterHandler struct {
+	DataStore *DataStore
+	Rules     RosterRules // zero value uses DefaultRosterRules
+}
+
+// rules returns the handler's configured rules, or the defaults if none were set
+func (h *RosterHandler) rules() RosterRules {
+	if h.Rules == (RosterRules{}) {
+		return DefaultRosterRules
+	}
+	return h.Rules
+}
+
+func (h *RosterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Take one snapshot of the data for the whole request, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+
+	switch action := pathParam(r, "/rosters/"); action {
+	case "validate":
+		h.serveValidate(w, r, snap)
+	case "options":
+		h.serveOptions(w, r, snap)
+	case "encode":
+		h.serveEncode(w, r, snap)
+	case "export":
+		h.serveExport(w, r, snap)
+	case "import":
+		h.serveImport(w, r, snap)
+	case "":
+		writeErrorJSON(w, http.StatusNotFound, "roster code required, e.g. /rosters/{code}")
+	default:
+		h.serveDecode(w, r, snap, action)
+	}
+}
+
+// serveValidate handles POST /rosters/validate
+func (h *RosterHandler) serveValidate(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Step 1: Parse request body
+	var roster Roster
+	if err := decodeJSONBody(w, r, &roster); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if roster.PointsLimit < 0 {
+		err := fmt.Errorf("points_limit cannot be negative, got %d", roster.PointsLimit)
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate and return every violation
+	result := ValidateRoster(roster, snap, h.rules())
+	log.Printf("validated roster of %d fighters for %s (%d violations)", result.FighterCount, r.RemoteAddr, len(result.Violations))
+	writeJSON(w, result)
+}
+
+// serveOptions handles POST /rosters/options, narrowing the candidates with /fighters filters in the query string
+func (h *RosterHandler) serveOptions(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Step 1: Validate fighter filters; they are read from the URL only, since ParseForm would consume
+	// the JSON body of a request sent as application/x-www-form-urlencoded
+	candidates, err := selectFighters(snap, r.URL.Query())
+	if err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Parse request body
+	var roster Roster
+	if err := decodeJSONBody(w, r, &roster); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if roster.PointsLimit < 0 {
+		err := fmt.Errorf("points_limit cannot be negative, got %d", roster.PointsLimit)
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Check every candidate against the partial roster
+	options := RosterAdditions(roster, candidates, snap, h.rules())
+	log.Printf("returning roster options from %d candidates to %s", len(candidates), r.RemoteAddr)
+	writeJSON(w, options)
+}
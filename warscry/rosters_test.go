@@ -0,0 +1,291 @@
+package warscry
+
+import (
+	"slices"
+	"testing"
+)
+
+// rosterTestSnapshot holds two warbands, one with an all-hero subfaction, plus an ally and a thrall
+func rosterTestSnapshot() *Snapshot {
+	fighters := Fighters{
+		{Id: "f1", Name: "Lord-Celestant", FactionRunemark: "stormcast-eternals", GrandAlliance: "order", Runemarks: []string{"hero", "leader"}, Points: 190, Wounds: 25, Toughness: 5},
+		{Id: "f2", Name: "Liberator", FactionRunemark: "stormcast-eternals", GrandAlliance: "order", Runemarks: []string{"warrior"}, Points: 95, Wounds: 20, Toughness: 5},
+		{Id: "f3", Name: "Prosecutor", FactionRunemark: "stormcast-eternals", GrandAlliance: "order", Runemarks: []string{"fly", "warrior"}, Points: 150, Wounds: 15, Toughness: 4},
+		{Id: "f4", Name: "Bloodreaver", FactionRunemark: "khorne", GrandAlliance: "chaos", Runemarks: []string{"berserker"}, Points: 60, Wounds: 8, Toughness: 3},
+		{Id: "f5", Name: "Mighty Lord of Khorne", FactionRunemark: "khorne", GrandAlliance: "chaos", Runemarks: []string{"hero", "leader"}, Points: 200, Wounds: 28, Toughness: 5},
+		{Id: "f6", Name: "Magore", FactionRunemark: "khorne", Subfaction: "magores-fiends", GrandAlliance: "chaos", Runemarks: []string{"hero", "leader"}, Points: 140, Wounds: 18, Toughness: 4},
+		{Id: "f7", Name: "Riptooth", FactionRunemark: "khorne", Subfaction: "magores-fiends", GrandAlliance: "chaos", Runemarks: []string{"hero", "beast"}, Points: 90, Wounds: 12, Toughness: 4},
+		{Id: "f8", Name: "Zharkus", FactionRunemark: "khorne", Subfaction: "magores-fiends", GrandAlliance: "chaos", Runemarks: []string{"hero", "berserker"}, Points: 80, Wounds: 14, Toughness: 4},
+		{Id: "f9", Name: "Chaos Troll", FactionRunemark: "chaos-beasts", GrandAlliance: "chaos", Runemarks: []string{"thrall", "monster"}, Points: 180, Wounds: 30, Toughness: 5},
+		{Id: "f10", Name: "Knight-Questor", FactionRunemark: "stormcast-eternals", GrandAlliance: "order", Runemarks: []string{"hero", "ally"}, Points: 140, Wounds: 22, Toughness: 5},
+	}
+	abilities := Abilities{}
+	return NewSnapshot(fighters, abilities, *LoadWarbands(&fighters, &abilities), 1, "test")
+}
+
+// entries builds roster entries from fighter ids, each included once
+func entries(ids ...string) []RosterEntry {
+	var fighters []RosterEntry
+	for _, id := range ids {
+		fighters = append(fighters, RosterEntry{FighterId: id})
+	}
+	return fighters
+}
+
+func TestValidateRoster(t *testing.T) {
+	snap := rosterTestSnapshot()
+
+	tests := []struct {
+		name         string
+		roster       Roster
+		rules        *RosterRules // DefaultRosterRules if nil
+		violations   []string
+		warband      string
+		points       int
+		fighterCount int
+	}{
+		{
+			name:         "valid roster",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2", Count: 2}}},
+			warband:      "stormcast-eternals",
+			points:       380,
+			fighterCount: 3,
+		},
+		{
+			name:         "repeated fighters are merged",
+			roster:       Roster{Fighters: entries("f1", "f2", "f2")},
+			warband:      "stormcast-eternals",
+			points:       380,
+			fighterCount: 3,
+		},
+		{
+			name:         "warband is matched case-insensitively",
+			roster:       Roster{Warband: "KHORNE", Fighters: entries("f5", "f4", "f4")},
+			warband:      "khorne",
+			points:       320,
+			fighterCount: 3,
+		},
+		{
+			name:         "warband is inferred from the first warband fighter",
+			roster:       Roster{Fighters: entries("f10", "f1", "f2")},
+			warband:      "stormcast-eternals",
+			points:       425,
+			fighterCount: 3,
+		},
+		{
+			name:         "unknown fighter",
+			roster:       Roster{Fighters: entries("f1", "f2", "f3", "missing")},
+			violations:   []string{ViolationUnknownFighter},
+			warband:      "stormcast-eternals",
+			points:       435,
+			fighterCount: 3,
+		},
+		{
+			name:         "negative count",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2", Count: 2}, {FighterId: "f3", Count: -1}}},
+			violations:   []string{ViolationInvalidCount},
+			warband:      "stormcast-eternals",
+			points:       380,
+			fighterCount: 3,
+		},
+		{
+			name:         "count above the cap",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2", Count: 2}, {FighterId: "f3", Count: maxFighterCount + 1}}},
+			violations:   []string{ViolationInvalidCount},
+			warband:      "stormcast-eternals",
+			points:       380,
+			fighterCount: 3,
+		},
+		{
+			name:         "merged count above the cap",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2", Count: 60}, {FighterId: "f2", Count: 60}}},
+			violations:   []string{ViolationInvalidCount, ViolationPointsExceeded, ViolationTooManyFighters},
+			warband:      "stormcast-eternals",
+			points:       190 + 60*95,
+			fighterCount: 61,
+		},
+		{
+			name:         "unknown warband",
+			roster:       Roster{Warband: "missing", Fighters: entries("f1", "f2", "f3")},
+			violations:   []string{ViolationUnknownWarband, ViolationMixedFactions},
+			warband:      "missing",
+			points:       435,
+			fighterCount: 3,
+		},
+		{
+			name:         "unknown subfaction",
+			roster:       Roster{Subfaction: "missing", Fighters: entries("f5", "f4", "f4")},
+			violations:   []string{ViolationUnknownSubfaction, ViolationSubfactionMismatch},
+			warband:      "khorne",
+			points:       320,
+			fighterCount: 3,
+		},
+		{
+			name:         "points limit exceeded",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f3", Count: 6}}},
+			violations:   []string{ViolationPointsExceeded},
+			warband:      "stormcast-eternals",
+			points:       1090,
+			fighterCount: 7,
+		},
+		{
+			name:         "roster points limit overrides the rules",
+			roster:       Roster{PointsLimit: 400, Fighters: entries("f1", "f2", "f3")},
+			violations:   []string{ViolationPointsExceeded},
+			warband:      "stormcast-eternals",
+			points:       435,
+			fighterCount: 3,
+		},
+		{
+			name:         "mixed factions",
+			roster:       Roster{Fighters: entries("f1", "f2", "f4")},
+			violations:   []string{ViolationMixedFactions},
+			warband:      "stormcast-eternals",
+			points:       345,
+			fighterCount: 3,
+		},
+		{
+			name:         "subfaction mismatch",
+			roster:       Roster{Subfaction: "magores-fiends", Fighters: entries("f6", "f7", "f4")},
+			violations:   []string{ViolationSubfactionMismatch},
+			warband:      "khorne",
+			points:       290,
+			fighterCount: 3,
+		},
+		{
+			name:         "allied thrall from another grand alliance",
+			roster:       Roster{Fighters: entries("f1", "f2", "f9")},
+			violations:   []string{ViolationGrandAllianceMismatch},
+			warband:      "stormcast-eternals",
+			points:       465,
+			fighterCount: 3,
+		},
+		{
+			name:         "thrall from the same grand alliance",
+			roster:       Roster{Fighters: entries("f5", "f4", "f9")},
+			warband:      "khorne",
+			points:       440,
+			fighterCount: 3,
+		},
+		{
+			name:         "no leader",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f2", Count: 3}}},
+			violations:   []string{ViolationNoLeader},
+			warband:      "stormcast-eternals",
+			points:       285,
+			fighterCount: 3,
+		},
+		{
+			name:         "too many leaders and heroes",
+			roster:       Roster{Fighters: entries("f5", "f6", "f7")},
+			violations:   []string{ViolationTooManyLeaders, ViolationTooManyHeroes},
+			warband:      "khorne",
+			points:       430,
+			fighterCount: 3,
+		},
+		{
+			name:         "all-hero subfaction has no hero limit",
+			roster:       Roster{Fighters: entries("f6", "f7", "f8")},
+			warband:      "khorne",
+			points:       310,
+			fighterCount: 3,
+		},
+		{
+			name:         "duplicate hero",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1", Count: 2}, {FighterId: "f2"}}},
+			violations:   []string{ViolationTooManyLeaders, ViolationDuplicateHero},
+			warband:      "stormcast-eternals",
+			points:       475,
+			fighterCount: 3,
+		},
+		{
+			name:         "too many allies",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2"}, {FighterId: "f10", Count: 2}}},
+			violations:   []string{ViolationTooManyHeroes, ViolationDuplicateHero, ViolationTooManyAllies},
+			warband:      "stormcast-eternals",
+			points:       565,
+			fighterCount: 4,
+		},
+		{
+			name:         "too many thralls",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f5"}, {FighterId: "f9", Count: 2}}},
+			violations:   []string{ViolationTooManyThralls},
+			warband:      "khorne",
+			points:       560,
+			fighterCount: 3,
+		},
+		{
+			name:         "too few fighters",
+			roster:       Roster{Fighters: entries("f1")},
+			violations:   []string{ViolationTooFewFighters},
+			warband:      "stormcast-eternals",
+			points:       190,
+			fighterCount: 1,
+		},
+		{
+			name:         "too many fighters under custom rules",
+			roster:       Roster{Fighters: []RosterEntry{{FighterId: "f1"}, {FighterId: "f2", Count: 3}}},
+			rules:        &RosterRules{PointsLimit: 1000, MinFighters: 1, MaxFighters: 3, Leaders: 1, MaxHeroes: 2, MaxAllies: 1, MaxThralls: 1},
+			violations:   []string{ViolationTooManyFighters},
+			warband:      "stormcast-eternals",
+			points:       475,
+			fighterCount: 4,
+		},
+		{
+			name:       "empty roster",
+			roster:     Roster{},
+			violations: []string{ViolationNoLeader, ViolationTooFewFighters},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRosterRules
+			if tt.rules != nil {
+				rules = *tt.rules
+			}
+			got := ValidateRoster(tt.roster, snap, rules)
+
+			var codes []string
+			for _, v := range got.Violations {
+				codes = append(codes, v.Code)
+			}
+			if !slices.Equal(codes, tt.violations) {
+				t.Errorf("violations = %v, want %v", codes, tt.violations)
+			}
+			if got.Valid != (len(tt.violations) == 0) {
+				t.Errorf("Valid = %v with violations %v", got.Valid, codes)
+			}
+			if got.Warband != tt.warband {
+				t.Errorf("Warband = %q, want %q", got.Warband, tt.warband)
+			}
+			if got.Points != tt.points {
+				t.Errorf("Points = %d, want %d", got.Points, tt.points)
+			}
+			if got.FighterCount != tt.fighterCount {
+				t.Errorf("FighterCount = %d, want %d", got.FighterCount, tt.fighterCount)
+			}
+		})
+	}
+}
+
+func TestValidateRosterRoles(t *testing.T) {
+	got := ValidateRoster(Roster{Subfaction: "MAGORES-FIENDS", Fighters: entries("f6", "f7", "f9")}, rosterTestSnapshot(), DefaultRosterRules)
+
+	if got.Subfaction != "magores-fiends" {
+		t.Errorf("Subfaction = %q, want magores-fiends", got.Subfaction)
+	}
+	if got.GrandAlliance != "chaos" {
+		t.Errorf("GrandAlliance = %q, want chaos", got.GrandAlliance)
+	}
+	if got.Leaders != 1 || got.Heroes != 2 || got.Thralls != 1 || got.Allies != 0 {
+		t.Errorf("Leaders, Heroes, Thralls, Allies = %d, %d, %d, %d, want 1, 2, 1, 0", got.Leaders, got.Heroes, got.Thralls, got.Allies)
+	}
+	var roles []string
+	for _, f := range got.Fighters {
+		roles = append(roles, f.Role)
+	}
+	if want := []string{RoleWarband, RoleWarband, RoleThrall}; !slices.Equal(roles, want) {
+		t.Errorf("roles = %v, want %v", roles, want)
+	}
+}
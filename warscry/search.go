@@ -0,0 +1,331 @@
+package warscry
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Search result types
+const (
+	SearchFighter = "fighter"
+	SearchAbility = "ability"
+)
+
+// defaultSearchLimit caps /search results when no limit is requested
+const defaultSearchLimit = 20
+
+// snippetRadius is the number of words kept either side of the first match in a snippet
+const snippetRadius = 8
+
+// searchField is a piece of text indexed for a document, weighted by how much a match in it should count
+type searchField struct {
+	name   string
+	text   string
+	weight float64
+}
+
+// searchDocument is a fighter or ability in the search index
+type searchDocument struct {
+	kind    string
+	id      string
+	name    string
+	warband Runemark
+	fields  []searchField
+}
+
+// posting records how often a term appears in one field of one document
+type posting struct {
+	doc   int
+	field int
+	count int
+}
+
+// SearchIndex is an inverted index over fighter and ability text, built once per data load
+type SearchIndex struct {
+	docs     []searchDocument
+	postings map[string][]posting
+}
+
+// SearchResult is a ranked match with the snippet of the field that matched best
+type SearchResult struct {
+	Type    string   `json:"type"`
+	Id      string   `json:"_id"`
+	Name    string   `json:"name"`
+	Warband Runemark `json:"warband"`
+	Score   float64  `json:"score"`
+	Field   string   `json:"field"`
+	Snippet string   `json:"snippet"`
+
+	matched int // distinct query terms found in the document
+}
+
+// NewSearchIndex indexes fighter names, runemarks, weapon runemarks and warbands, and ability names, descriptions and warbands
+func NewSearchIndex(fighters Fighters, abilities Abilities) *SearchIndex {
+	index := &SearchIndex{postings: make(map[string][]posting)}
+
+	for _, f := range fighters {
+		var weapons []string
+		for _, w := range f.Weapons {
+			weapons = append(weapons, w.Runemark)
+		}
+		index.add(searchDocument{
+			kind: SearchFighter, id: f.Id, name: f.Name, warband: f.FactionRunemark,
+			fields: []searchField{
+				{"name", f.Name, 3},
+				{"runemarks", strings.Join(f.Runemarks, ", "), 2},
+				{"weapons", strings.Join(weapons, ", "), 1},
+				{"warband", f.FactionRunemark, 1},
+				{"subfaction", f.Subfaction, 1},
+			},
+		})
+	}
+	for _, a := range abilities {
+		index.add(searchDocument{
+			kind: SearchAbility, id: a.Id, name: a.Name, warband: a.FactionRunemark,
+			fields: []searchField{
+				{"name", a.Name, 3},
+				{"runemarks", strings.Join(a.Runemarks, ", "), 2},
+				{"description", a.Description, 1},
+				{"warband", a.FactionRunemark, 1},
+			},
+		})
+	}
+	return index
+}
+
+// add appends a document and its term postings to the index
+func (idx *SearchIndex) add(doc searchDocument) {
+	docId := len(idx.docs)
+	idx.docs = append(idx.docs, doc)
+	for fieldId, field := range doc.fields {
+		counts := make(map[string]int)
+		for _, token := range searchWords(field.text) {
+			counts[stem(token)]++
+		}
+		for term, count := range counts {
+			idx.postings[term] = append(idx.postings[term], posting{doc: docId, field: fieldId, count: count})
+		}
+	}
+}
+
+// Search ranks documents by how many distinct query terms they contain, then by the weighted frequency
+// of each term scaled by how rare the term is
+func (idx *SearchIndex) Search(query string, kind string) []SearchResult {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+
+	scores := make(map[int]float64)
+	matched := make(map[int]int)   // distinct query terms matched per document
+	bestField := make(map[int]int) // highest scoring field per document
+	fieldScore := make(map[int]float64)
+	for _, term := range terms {
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(len(idx.docs))/float64(len(postings)))
+		seen := make(map[int]bool)
+		for _, p := range postings {
+			doc := &idx.docs[p.doc]
+			if kind != "" && doc.kind != kind {
+				continue
+			}
+			score := doc.fields[p.field].weight * float64(p.count) * idf
+			scores[p.doc] += score
+			if !seen[p.doc] {
+				matched[p.doc]++
+				seen[p.doc] = true
+			}
+			if score > fieldScore[p.doc] {
+				fieldScore[p.doc] = score
+				bestField[p.doc] = p.field
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for docId, score := range scores {
+		doc := &idx.docs[docId]
+		field := doc.fields[bestField[docId]]
+		results = append(results, SearchResult{
+			Type:    doc.kind,
+			Id:      doc.id,
+			Name:    doc.name,
+			Warband: doc.warband,
+			Score:   math.Round(score*1000) / 1000,
+			Field:   field.name,
+			Snippet: snippet(field.text, terms),
+			matched: matched[docId],
+		})
+	}
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		if c := cmp.Compare(b.matched, a.matched); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+			return c
+		}
+		// results are collected from a map, so type and _id settle the rest for stable paging
+		if c := cmp.Compare(a.Type, b.Type); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return results
+}
+
+// searchTerms tokenizes and stems a query, dropping repeated terms
+func searchTerms(query string) []string {
+	var terms []string
+	for _, token := range searchWords(query) {
+		if term := stem(token); !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// searchWords lowercases text and splits it into runs of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stem reduces a lowercase token to a crude root so plural and verb forms match, e.g. wounds and wounding become wound
+func stem(token string) string {
+	if len(token) <= 3 {
+		return token
+	}
+	switch {
+	case strings.HasSuffix(token, "ies") && len(token) > 4:
+		token = strings.TrimSuffix(token, "ies") + "y"
+	case strings.HasSuffix(token, "sses"):
+		token = strings.TrimSuffix(token, "es")
+	case strings.HasSuffix(token, "ing") && len(token) > 5:
+		token = undouble(strings.TrimSuffix(token, "ing"))
+	case strings.HasSuffix(token, "ed") && len(token) > 4:
+		token = undouble(strings.TrimSuffix(token, "ed"))
+	case strings.HasSuffix(token, "s") && !strings.HasSuffix(token, "ss") && !strings.HasSuffix(token, "us"):
+		token = strings.TrimSuffix(token, "s")
+	}
+	// a trailing e is dropped so move, moved and moving share a root
+	if len(token) > 3 && strings.HasSuffix(token, "e") {
+		token = strings.TrimSuffix(token, "e")
+	}
+	return token
+}
+
+// undouble removes a doubled final consonant left by suffix stripping, e.g. runn becomes run
+func undouble(token string) string {
+	n := len(token)
+	if n >= 2 && token[n-1] == token[n-2] && !strings.ContainsRune("aeiouls", rune(token[n-1])) {
+		return token[:n-1]
+	}
+	return token
+}
+
+// snippet returns up to snippetRadius words either side of the first matching word as HTML, escaped, with matches
+// wrapped in <mark>
+func snippet(text string, terms []string) string {
+	words := strings.Fields(text)
+	first := -1
+	marked := make([]string, len(words))
+	for i, word := range words {
+		marked[i] = html.EscapeString(word)
+		for _, token := range searchWords(word) {
+			if slices.Contains(terms, stem(token)) {
+				marked[i] = "<mark>" + marked[i] + "</mark>"
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	start := max(0, first-snippetRadius)
+	end := min(len(words), first+snippetRadius+1)
+	result := strings.Join(marked[start:end], " ")
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(words) {
+		result += "…"
+	}
+	return result
+}
+
+// validSearchParams lists all recognized query parameters for /search endpoint
+var validSearchParams = map[string]fieldKind{
+	"q": controlField, "type": controlField,
+	"limit": controlField, "offset": controlField, "cursor": controlField,
+}
+
+type SearchHandler struct {
+	DataStore *DataStore
+}
+
+func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the current index from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	index := snap.GetSearchIndex()
+
+	// Step 1: Parse form data
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate query parameters; q is required
+	if err := validateQueryParams(r.Form, validSearchParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(r.Form, "type", []string{SearchFighter, SearchAbility}); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	query := strings.TrimSpace(r.Form.Get("q"))
+	if query == "" {
+		err := QueryError{Parameter: "q", Value: query, Reason: "search text is required"}
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 3: Validate paging
+	page, pageErr := parsePage(r.Form, snap.Hash)
+	if pageErr != nil {
+		writeErrorJSON(w, http.StatusBadRequest, pageErr.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, pageErr)
+		return
+	}
+	if page.Limit == 0 {
+		page.Limit = defaultSearchLimit
+	}
+
+	// Step 4: Rank and return one page of results
+	results := index.Search(query, strings.ToLower(r.Form.Get("type")))
+	setPageHeaders(w, r, len(results), page, snap.Hash)
+	log.Printf("returning %d of %d search results to %s", len(paginate(results, page)), len(results), r.RemoteAddr)
+	writeJSON(w, paginate(results, page))
+}
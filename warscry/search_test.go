@@ -0,0 +1,97 @@
+package warscry
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		// short tokens are left alone
+		{"axe", "axe"},
+		{"red", "red"},
+		// plurals
+		{"wounds", "wound"},
+		{"abilities", "ability"},
+		{"enemies", "enemy"},
+		{"ties", "tie"},
+		{"passes", "pass"},
+		{"pass", "pass"},
+		{"bonus", "bonus"},
+		// verb forms
+		{"wounding", "wound"},
+		{"wounded", "wound"},
+		{"king", "king"},
+		{"bred", "bred"},
+		// doubled consonants left by suffix stripping
+		{"running", "run"},
+		{"hitting", "hit"},
+		{"rolled", "roll"},
+		{"missed", "miss"},
+		// a trailing e is dropped so every form shares a root
+		{"move", "mov"},
+		{"moves", "mov"},
+		{"moved", "mov"},
+		{"moving", "mov"},
+		{"range", "rang"},
+		{"ranges", "rang"},
+		{"ranged", "rang"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			if got := stem(tt.token); got != tt.want {
+				t.Errorf("stem(%q) = %q, want %q", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"marks matches", "Heal 3 wounds", []string{"wound"}, "Heal 3 <mark>wounds</mark>"},
+		{"no match", "Roll a dice", []string{"wound"}, "Roll a dice"},
+		{"escapes text", `Pick a <b>visible</b> "enemy" & ally`, []string{"enemy"}, `Pick a &lt;b&gt;visible&lt;/b&gt; <mark>&#34;enemy&#34;</mark> &amp; ally`},
+		{
+			"trims around the first match",
+			"one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty wound",
+			[]string{"wound"},
+			"…thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty <mark>wound</mark>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(tt.text, tt.terms); got != tt.want {
+				t.Errorf("snippet(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchOrderIsStable(t *testing.T) {
+	// identical fighters score the same, so only the final tie-breakers order them
+	var fighters Fighters
+	for _, id := range []string{"f3", "f1", "f4", "f2"} {
+		fighters = append(fighters, Fighter{Id: id, Name: "Liberator", FactionRunemark: "stormcast-eternals"})
+	}
+	index := NewSearchIndex(fighters, Abilities{})
+
+	for i := 0; i < 10; i++ {
+		var got []string
+		for _, result := range index.Search("liberator", "") {
+			got = append(got, result.Id)
+		}
+		if want := []string{"f1", "f2", "f3", "f4"}; !slices.Equal(got, want) {
+			t.Fatalf("Search returned %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package warscry
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Suggestion types, also accepted by /suggest?type=
+const (
+	SuggestFighter  = "fighter"
+	SuggestAbility  = "ability"
+	SuggestWarband  = "warband"
+	SuggestRunemark = "runemark"
+)
+
+var validSuggestTypes = []string{SuggestFighter, SuggestAbility, SuggestWarband, SuggestRunemark}
+
+// How a suggestion matched, best first
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchWord   = "word"
+	MatchFuzzy  = "fuzzy"
+)
+
+var suggestMatchOrder = []string{MatchExact, MatchPrefix, MatchWord, MatchFuzzy}
+
+// defaultSuggestLimit and maxSuggestLimit cap the number of suggestions returned
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+// suggestEntry is a name that can be suggested
+type suggestEntry struct {
+	kind  string
+	value string
+	id    string
+}
+
+// suggestKey is one word start of a normalized entry name, so "lord celestant" is found from "lord" and "celestant"
+type suggestKey struct {
+	text  string
+	entry int
+	word  int // index of the word the key starts at, 0 for the whole name
+}
+
+// SuggestIndex holds the names behind /suggest, built once per data load
+// Keys are sorted so prefix completion is a binary search
+type SuggestIndex struct {
+	entries []suggestEntry
+	keys    []suggestKey
+}
+
+// Suggestion is a completed or corrected name
+type Suggestion struct {
+	Type  string  `json:"type"`
+	Value string  `json:"value"`
+	Id    string  `json:"_id,omitempty"`
+	Match string  `json:"match"`
+	Score float64 `json:"score"`
+}
+
+// NewSuggestIndex indexes fighter and ability names, warband names and the runemarks used by fighters and abilities
+func NewSuggestIndex(fighters Fighters, abilities Abilities, warbands Warbands) *SuggestIndex {
+	index := &SuggestIndex{}
+	var runemarks []string
+
+	for _, f := range fighters {
+		index.add(suggestEntry{kind: SuggestFighter, value: f.Name, id: f.Id})
+		runemarks = append(runemarks, f.Runemarks...)
+	}
+	for _, a := range abilities {
+		index.add(suggestEntry{kind: SuggestAbility, value: a.Name, id: a.Id})
+		runemarks = append(runemarks, a.Runemarks...)
+	}
+	for _, wb := range warbands {
+		index.add(suggestEntry{kind: SuggestWarband, value: wb.Name})
+	}
+	slices.Sort(runemarks)
+	for _, rm := range slices.Compact(runemarks) {
+		index.add(suggestEntry{kind: SuggestRunemark, value: rm})
+	}
+
+	slices.SortFunc(index.keys, func(a, b suggestKey) int { return cmp.Compare(a.text, b.text) })
+	return index
+}
+
+// add appends an entry and a key for each of its word starts
+func (idx *SuggestIndex) add(entry suggestEntry) {
+	entryId := len(idx.entries)
+	idx.entries = append(idx.entries, entry)
+	words := strings.Fields(normalizeName(entry.value))
+	for i := range words {
+		idx.keys = append(idx.keys, suggestKey{text: strings.Join(words[i:], " "), entry: entryId, word: i})
+	}
+}
+
+// Suggest completes query as a prefix of a name or of any word in it, falling back to typo-tolerant
+// matches when there are fewer than limit completions. kind limits suggestions to one type if not empty
+func (idx *SuggestIndex) Suggest(query string, kind string, limit int) []Suggestion {
+	normalized := normalizeName(query)
+	if normalized == "" {
+		return []Suggestion{}
+	}
+
+	found := make(map[int]Suggestion)
+	consider := func(entryId int, match string, score float64) {
+		entry := idx.entries[entryId]
+		if kind != "" && entry.kind != kind {
+			return
+		}
+		if existing, seen := found[entryId]; seen && !betterSuggestion(match, score, existing) {
+			return
+		}
+		found[entryId] = Suggestion{
+			Type:  entry.kind,
+			Value: entry.value,
+			Id:    entry.id,
+			Match: match,
+			Score: math.Round(score*1000) / 1000,
+		}
+	}
+
+	// prefix completion: keys sharing the prefix are contiguous in sorted order
+	start, _ := slices.BinarySearchFunc(idx.keys, normalized, func(k suggestKey, q string) int {
+		return cmp.Compare(k.text, q)
+	})
+	for i := start; i < len(idx.keys) && strings.HasPrefix(idx.keys[i].text, normalized); i++ {
+		key := idx.keys[i]
+		name := normalizeName(idx.entries[key.entry].value)
+		score := float64(len(normalized)) / float64(len(name))
+		switch {
+		case key.word == 0 && key.text == normalized:
+			consider(key.entry, MatchExact, 1)
+		case key.word == 0:
+			consider(key.entry, MatchPrefix, score)
+		default:
+			consider(key.entry, MatchWord, score)
+		}
+	}
+
+	// typo tolerance: only scan every name if completion didn't fill the limit
+	if len(found) < limit {
+		for entryId, entry := range idx.entries {
+			if _, seen := found[entryId]; seen {
+				continue
+			}
+			if score := nameSimilarity(query, entry.value); score >= minFuzzySimilarity {
+				consider(entryId, MatchFuzzy, score)
+			}
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(found))
+	for _, s := range found {
+		suggestions = append(suggestions, s)
+	}
+	slices.SortFunc(suggestions, compareSuggestions)
+	return suggestions[:min(limit, len(suggestions))]
+}
+
+// betterSuggestion reports whether a match of the given kind and score beats an existing suggestion
+func betterSuggestion(match string, score float64, existing Suggestion) bool {
+	if c := cmp.Compare(slices.Index(suggestMatchOrder, match), slices.Index(suggestMatchOrder, existing.Match)); c != 0 {
+		return c < 0
+	}
+	return score > existing.Score
+}
+
+// compareSuggestions orders suggestions by match kind, then score, then shorter and alphabetically earlier names,
+// then type and _id
+func compareSuggestions(a, b Suggestion) int {
+	if c := cmp.Compare(slices.Index(suggestMatchOrder, a.Match), slices.Index(suggestMatchOrder, b.Match)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(len(a.Value), len(b.Value)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(strings.ToLower(a.Value), strings.ToLower(b.Value)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Type, b.Type); c != 0 {
+		return c
+	}
+	// suggestions are collected from a map, and fighters may share a name, so _id settles the order
+	return cmp.Compare(a.Id, b.Id)
+}
+
+// validSuggestParams lists all recognized query parameters for /suggest endpoint
+var validSuggestParams = map[string]fieldKind{
+	"q": controlField, "type": controlField, "limit": controlField,
+}
+
+type SuggestHandler struct {
+	DataStore *DataStore
+}
+
+func (h *SuggestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Get the current index from one DataStore snapshot, identified in the response headers
+	snap := h.DataStore.SnapshotFor(w)
+	index := snap.GetSuggestIndex()
+
+	// Step 1: Parse form data
+	if err := r.ParseForm(); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// Step 2: Validate query parameters; q is required
+	if err := validateQueryParams(r.Form, validSuggestParams); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateChoiceParam(r.Form, "type", validSuggestTypes); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	query := r.Form.Get("q")
+	if normalizeName(query) == "" {
+		err := QueryError{Parameter: "q", Value: query, Reason: "text to complete is required"}
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	if err := validateFuzzyParam("q", r.Form["q"]); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	limit := defaultSuggestLimit
+	if v := r.Form.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSuggestLimit {
+			err := QueryError{Parameter: "limit", Value: v, Reason: fmt.Sprintf("must be an integer from 1 to %d", maxSuggestLimit)}
+			writeErrorJSON(w, http.StatusBadRequest, err.Error())
+			log.Printf("Bad request from %s: %v", r.RemoteAddr, err)
+			return
+		}
+		limit = n
+	}
+
+	// Step 3: Complete and rank
+	suggestions := index.Suggest(query, strings.ToLower(r.Form.Get("type")), limit)
+	log.Printf("returning %d suggestions to %s", len(suggestions), r.RemoteAddr)
+	writeJSON(w, suggestions)
+}
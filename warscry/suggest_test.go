@@ -0,0 +1,25 @@
+package warscry
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSuggestOrderIsStable(t *testing.T) {
+	// fighters sharing a name are equally good suggestions, so only _id orders them
+	var fighters Fighters
+	for _, id := range []string{"f3", "f1", "f4", "f2"} {
+		fighters = append(fighters, Fighter{Id: id, Name: "Liberator", FactionRunemark: "stormcast-eternals"})
+	}
+	index := NewSuggestIndex(fighters, Abilities{}, Warbands{})
+
+	for i := 0; i < 10; i++ {
+		var got []string
+		for _, s := range index.Suggest("libera", SuggestFighter, 10) {
+			got = append(got, s.Id)
+		}
+		if want := []string{"f1", "f2", "f3", "f4"}; !slices.Equal(got, want) {
+			t.Fatalf("Suggest returned %v, want %v", got, want)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package warscry
 import (
 	"errors"
 	"log"
+	"net/http"
 	"slices"
+	"strconv"
+	"strings"
 )
 
 func (W *Warband) AddFighter(f *Fighter) error {
@@ -38,6 +41,9 @@ func LoadWarbands(F *Fighters, A *Abilities) *Warbands {
 
 	for _, f := range *F {
 		wb, _ := wbs[f.FactionRunemark]
+		if wb.GrandAlliance == "" {
+			wb.GrandAlliance = f.GrandAlliance
+		}
 		err := wb.AddFighter(&f)
 		if err != nil {
 			log.Fatalf("error while adding fighter -- %s", err)
@@ -51,13 +57,17 @@ func LoadWarbands(F *Fighters, A *Abilities) *Warbands {
 		}
 	}
 	for _, a := range *A {
+		// universal abilities belong to every warband, so they aren't grouped as a faction of their own
+		if a.Universal {
+			continue
+		}
 		faction := a.FactionRunemark
 		sfaction, _ := subfaction[a.FactionRunemark]
 		if sfaction != "" {
 			faction = sfaction
 		}
 		wb, _ := wbs[faction]
-		if a.Type == "battle_trait" {
+		if a.Type == CostBattleTrait {
 			wb.BattleTraits = append(wb.BattleTraits, a)
 		} else {
 			err := wb.AddAbility(&a)
@@ -73,7 +83,147 @@ func LoadWarbands(F *Fighters, A *Abilities) *Warbands {
 	for _, name := range wbslice {
 		toAdd := wbs[name]
 		toAdd.Name = name
+		toAdd.Subfactions = toAdd.groupSubfactions()
 		newW = append(newW, toAdd)
 	}
 	return &newW
 }
+
+// groupSubfactions builds the warband's subfactions from the subfaction runemarks of its fighters, in fighter order.
+// Abilities and battle traits whose faction runemark is a subfaction belong to that subfaction.
+func (W *Warband) groupSubfactions() []Subfaction {
+	var subfactions []Subfaction
+	for _, runemark := range W.SubfactionRunemarks() {
+		s := Subfaction{Runemark: runemark, HeroesAll: true}
+		for _, f := range W.Fighters {
+			if f.Subfaction != runemark {
+				continue
+			}
+			s.Fighters = append(s.Fighters, f)
+			if !slices.Contains(f.Runemarks, HeroRunemark) {
+				s.HeroesAll = false
+			}
+		}
+		for _, a := range W.Abilities {
+			if strings.EqualFold(a.FactionRunemark, runemark) {
+				s.Abilities = append(s.Abilities, a)
+			}
+		}
+		for _, a := range W.BattleTraits {
+			if strings.EqualFold(a.FactionRunemark, runemark) {
+				s.BattleTraits = append(s.BattleTraits, a)
+			}
+		}
+		s.Bladeborn = len(s.Abilities) > 0 || len(s.BattleTraits) > 0
+		subfactions = append(subfactions, s)
+	}
+	return subfactions
+}
+
+// GetSubfaction returns the warband's subfaction with the given runemark (case-insensitive), or nil if none exists
+func (W *Warband) GetSubfaction(runemark string) *Subfaction {
+	for i := range W.Subfactions {
+		if strings.EqualFold(W.Subfactions[i].Runemark, runemark) {
+			return &W.Subfactions[i]
+		}
+	}
+	return nil
+}
+
+// GetWarband returns the warband with the given name (case-insensitive), or nil if none exists
+func (W *Warbands) GetWarband(name string) *Warband {
+	for i := range *W {
+		if strings.EqualFold((*W)[i].Name, name) {
+			return &(*W)[i]
+		}
+	}
+	return nil
+}
+
+// SubfactionRunemarks returns the distinct subfaction runemarks of the warband's fighters
+func (W *Warband) SubfactionRunemarks() []string {
+	var subfactions []string
+	for _, f := range W.Fighters {
+		if f.Subfaction != "" && !slices.Contains(subfactions, f.Subfaction) {
+			subfactions = append(subfactions, f.Subfaction)
+		}
+	}
+	return subfactions
+}
+
+// Without returns a copy of the warband with the requested nested collections left out, including from its subfactions
+// Left out fighters, abilities and battle traits marshal as null, as a warband without them always has
+func (W Warband) Without(exclude []string) Warband {
+	if len(exclude) == 0 {
+		return W
+	}
+	subfactions := make([]Subfaction, len(W.Subfactions))
+	for i := range W.Subfactions {
+		subfactions[i] = W.Subfactions[i].Without(exclude)
+	}
+	W.Subfactions = subfactions
+
+	for _, e := range exclude {
+		switch strings.ToLower(e) {
+		case "fighters":
+			W.Fighters = nil
+		case "abilities":
+			W.Abilities = nil
+		case "battle_traits":
+			W.BattleTraits = nil
+		case "subfactions":
+			W.Subfactions = nil
+		}
+	}
+	return W
+}
+
+// Without returns a copy of the subfaction with the requested nested collections left out
+func (S Subfaction) Without(exclude []string) Subfaction {
+	for _, e := range exclude {
+		switch strings.ToLower(e) {
+		case "fighters":
+			S.Fighters = nil
+		case "abilities":
+			S.Abilities = nil
+		case "battle_traits":
+			S.BattleTraits = nil
+		}
+	}
+	return S
+}
+
+// WithUniversal returns a copy of the warband with the universal abilities added after its own
+func (W Warband) WithUniversal(universal Abilities) Warband {
+	if len(universal) == 0 {
+		return W
+	}
+	W.Abilities = append(slices.Clip(W.Abilities), universal...)
+	return W
+}
+
+func (W *Warband) MatchesRequest(r *http.Request) bool {
+	var conditions []bool
+
+	// warband characteristics
+	conditions = append(conditions, StringParamInclude(W.Name, r.Form, "name"))
+	conditions = append(conditions, StringParamInclude(W.GrandAlliance, r.Form, "grand_alliance"))
+
+	// a warband matches a subfaction if any of its fighters belong to it
+	subfactionMatch := len(r.Form["subfaction"]) == 0
+	for _, s := range W.Subfactions {
+		if StringInclude(s.Runemark, r.Form["subfaction"]) {
+			subfactionMatch = true
+			break
+		}
+	}
+	conditions = append(conditions, subfactionMatch)
+
+	// a warband is bladeborn if any of its subfactions are
+	if len(r.Form["bladeborn"]) > 0 {
+		bladeborn := slices.ContainsFunc(W.Subfactions, func(s Subfaction) bool { return s.Bladeborn })
+		conditions = append(conditions, StringParamInclude(strconv.FormatBool(bladeborn), r.Form, "bladeborn"))
+	}
+
+	return All(conditions)
+}
@@ -0,0 +1,53 @@
+package warscry
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WeaponProfile is a single weapon flattened together with the fighter that carries it
+type WeaponProfile struct {
+	FighterId   FighterID   `json:"fighter_id"`
+	FighterName FighterName `json:"fighter_name"`
+	Warband     Runemark    `json:"warband"`
+	Weapon
+}
+
+// WeaponProfiles flattens every fighter's weapons into weapon profiles, in data order
+func (F *Fighters) WeaponProfiles() []WeaponProfile {
+	var profiles []WeaponProfile
+	for _, f := range *F {
+		for _, w := range f.Weapons {
+			profiles = append(profiles, WeaponProfile{
+				FighterId:   f.Id,
+				FighterName: f.Name,
+				Warband:     f.FactionRunemark,
+				Weapon:      w,
+			})
+		}
+	}
+	return profiles
+}
+
+func (p *WeaponProfile) MatchesRequest(r *http.Request) (bool, error) {
+	var conditions []bool
+
+	// owning fighter characteristics
+	conditions = append(conditions, StringParamInclude(p.FighterId, r.Form, "fighter_id"))
+	conditions = append(conditions, StringParamInclude(p.FighterName, r.Form, "fighter_name"))
+	conditions = append(conditions, StringParamInclude(p.Warband, r.Form, "warband"))
+
+	// weapon characteristics
+	weaponInclude, err := p.Weapon.MatchesRequest(r)
+	if err != nil {
+		return false, err
+	}
+	conditions = append(conditions, weaponInclude)
+
+	return All(conditions), nil
+}
+
+// matchedWeaponsOnly reports whether the request asks for fighters to carry only their matching weapons
+func matchedWeaponsOnly(r *http.Request) bool {
+	return strings.EqualFold(r.Form.Get("weapons"), "matched")
+}